@@ -0,0 +1,202 @@
+package api
+
+import (
+	"math"
+	"time"
+)
+
+// Forecasting models, from most to least history needed. fitForecast picks
+// the first one the series is long enough for.
+const (
+	holtWintersModel   = "holt_winters"
+	seasonalNaiveModel = "seasonal_naive"
+	naiveModel         = "naive"
+)
+
+// intervalZ is the normal quantile for the 95% prediction intervals.
+const intervalZ = 1.96
+
+// forecastPeriod describes one aggregation period of the traffic forecast.
+type forecastPeriod struct {
+	// Season is the number of periods in a seasonal cycle.
+	Season int
+	// Horizon is how many periods are forecast by default.
+	Horizon int
+	next    func(time.Time) time.Time
+}
+
+var forecastPeriods = map[string]forecastPeriod{
+	"day":   {Season: 7, Horizon: 14, next: func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	"week":  {Season: 52, Horizon: 8, next: func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }},
+	"month": {Season: 12, Horizon: 6, next: func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+}
+
+// forecast is the output of a fitted model. Point, Lower and Upper hold one
+// value per period ahead.
+type forecast struct {
+	Model               string
+	Point, Lower, Upper []float64
+}
+
+// fitForecast forecasts horizon periods past y, a series of counts with one
+// value per period and a seasonal cycle of season periods. Holt-Winters
+// needs two full cycles and seasonal naive one; shorter series fall back to
+// the naive forecast. Forecasts and intervals are clamped at zero.
+func fitForecast(y []float64, season, horizon int) forecast {
+	var f forecast
+	switch {
+	case season > 1 && len(y) >= 2*season:
+		f = holtWinters(y, season, horizon)
+	case season > 1 && len(y) >= season:
+		f = seasonalNaive(y, season, horizon)
+	default:
+		f = naive(y, horizon)
+	}
+	for i := range f.Point {
+		f.Point[i] = math.Max(f.Point[i], 0)
+		f.Lower[i] = math.Max(f.Lower[i], 0)
+		f.Upper[i] = math.Max(f.Upper[i], 0)
+	}
+	return f
+}
+
+// naive repeats the last value; the interval widens with the square root of
+// the horizon.
+func naive(y []float64, horizon int) forecast {
+	f := newForecast(naiveModel, horizon)
+	if len(y) == 0 {
+		return f
+	}
+	var residuals []float64
+	for t := 1; t < len(y); t++ {
+		residuals = append(residuals, y[t]-y[t-1])
+	}
+	sigma := rmse(residuals)
+	last := y[len(y)-1]
+	for h := 1; h <= horizon; h++ {
+		f.set(h, last, sigma*math.Sqrt(float64(h)))
+	}
+	return f
+}
+
+// seasonalNaive repeats the value from the same period of the last cycle;
+// the interval widens with each further cycle ahead.
+func seasonalNaive(y []float64, season, horizon int) forecast {
+	f := newForecast(seasonalNaiveModel, horizon)
+	var residuals []float64
+	for t := season; t < len(y); t++ {
+		residuals = append(residuals, y[t]-y[t-season])
+	}
+	sigma := rmse(residuals)
+	n := len(y)
+	for h := 1; h <= horizon; h++ {
+		cycles := (h-1)/season + 1
+		f.set(h, y[n-season+(h-1)%season], sigma*math.Sqrt(float64(cycles)))
+	}
+	return f
+}
+
+// holtWinters fits additive Holt-Winters, choosing the smoothing parameters
+// from a grid by in-sample one-step error. Intervals use the variance of the
+// equivalent ETS(A,A,A) model.
+func holtWinters(y []float64, season, horizon int) forecast {
+	grid := []float64{0.1, 0.3, 0.5, 0.7, 0.9}
+	best := hwFit{sse: math.Inf(1)}
+	for _, alpha := range grid {
+		for _, beta := range grid {
+			for _, gamma := range grid {
+				if fit := fitHoltWinters(y, season, alpha, beta, gamma); fit.sse < best.sse {
+					best = fit
+				}
+			}
+		}
+	}
+
+	f := newForecast(holtWintersModel, horizon)
+	sigma := math.Sqrt(best.sse / float64(len(y)-season))
+	variance := 1.0
+	for h := 1; h <= horizon; h++ {
+		if h > 1 {
+			j := float64(h - 1)
+			c := best.alpha * (1 + j*best.beta)
+			if (h-1)%season == 0 {
+				c += best.gamma
+			}
+			variance += c * c
+		}
+		point := best.level + float64(h)*best.trend + best.seasonal[(len(y)+h-1)%season]
+		f.set(h, point, sigma*math.Sqrt(variance))
+	}
+	return f
+}
+
+type hwFit struct {
+	alpha, beta, gamma float64
+	level, trend       float64
+	seasonal           []float64
+	sse                float64
+}
+
+func fitHoltWinters(y []float64, season int, alpha, beta, gamma float64) hwFit {
+	first, second := mean(y[:season]), mean(y[season:2*season])
+	fit := hwFit{
+		alpha: alpha, beta: beta, gamma: gamma,
+		level:    first,
+		trend:    (second - first) / float64(season),
+		seasonal: make([]float64, season),
+	}
+	for i := 0; i < season; i++ {
+		fit.seasonal[i] = y[i] - first
+	}
+
+	for t := season; t < len(y); t++ {
+		s := fit.seasonal[t%season]
+		e := y[t] - (fit.level + fit.trend + s)
+		fit.sse += e * e
+
+		level := alpha*(y[t]-s) + (1-alpha)*(fit.level+fit.trend)
+		fit.trend = beta*(level-fit.level) + (1-beta)*fit.trend
+		fit.level = level
+		fit.seasonal[t%season] = gamma*(y[t]-level) + (1-gamma)*s
+	}
+	return fit
+}
+
+func newForecast(model string, horizon int) forecast {
+	return forecast{
+		Model: model,
+		Point: make([]float64, horizon),
+		Lower: make([]float64, horizon),
+		Upper: make([]float64, horizon),
+	}
+}
+
+// set records the forecast h periods ahead with standard error se.
+func (f forecast) set(h int, point, se float64) {
+	f.Point[h-1] = point
+	f.Lower[h-1] = point - intervalZ*se
+	f.Upper[h-1] = point + intervalZ*se
+}
+
+func mean(v []float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+// rmse is the root mean square of residuals, or 0 if there are none.
+func rmse(residuals []float64) float64 {
+	if len(residuals) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, r := range residuals {
+		sum += r * r
+	}
+	return math.Sqrt(sum / float64(len(residuals)))
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+// series returns n periods of a weekly pattern starting on its first day.
+func series(n int) []float64 {
+	pattern := []float64{10, 12, 14, 16, 30, 40, 20}
+	y := make([]float64, n)
+	for t := range y {
+		y[t] = pattern[t%len(pattern)]
+	}
+	return y
+}
+
+func TestFitForecastModel(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		season int
+		want   string
+	}{
+		{"empty", 0, 7, naiveModel},
+		{"under one cycle", 6, 7, naiveModel},
+		{"one cycle", 7, 7, seasonalNaiveModel},
+		{"under two cycles", 13, 7, seasonalNaiveModel},
+		{"two cycles", 14, 7, holtWintersModel},
+		{"long", 60, 7, holtWintersModel},
+		{"no season", 60, 1, naiveModel},
+	}
+	for _, tt := range tests {
+		f := fitForecast(series(tt.n), tt.season, 5)
+		if f.Model != tt.want {
+			t.Errorf("%s: got model %s, want %s", tt.name, f.Model, tt.want)
+		}
+	}
+}
+
+func TestFitForecastHorizon(t *testing.T) {
+	for _, n := range []int{0, 3, 7, 20} {
+		for _, horizon := range []int{1, 14, 30} {
+			f := fitForecast(series(n), 7, horizon)
+			if len(f.Point) != horizon || len(f.Lower) != horizon || len(f.Upper) != horizon {
+				t.Errorf("%s with %d periods: got %d/%d/%d values, want %d", f.Model, n, len(f.Point), len(f.Lower), len(f.Upper), horizon)
+			}
+		}
+	}
+}
+
+// A series that repeats its pattern exactly is forecast to continue it,
+// from wherever in the cycle the series ends.
+func TestFitForecastSeasonalAlignment(t *testing.T) {
+	pattern := series(7)
+	for _, n := range []int{7, 10, 14, 17, 20} {
+		f := fitForecast(series(n), 7, 9)
+		for h := 1; h <= 9; h++ {
+			want := pattern[(n+h-1)%7]
+			if math.Abs(f.Point[h-1]-want) > 1e-9 {
+				t.Errorf("%s with %d periods, %d ahead: got %v, want %v", f.Model, n, h, f.Point[h-1], want)
+			}
+		}
+	}
+}
+
+func TestFitForecastIntervals(t *testing.T) {
+	width := func(f forecast, h int) float64 { return f.Upper[h-1] - f.Lower[h-1] }
+
+	// Naive: the one-step residuals 2, -1, 2 have an RMSE of sqrt(3), and
+	// the interval widens with the square root of the horizon.
+	f := fitForecast([]float64{11, 13, 12, 14}, 7, 4)
+	for h := 1; h <= 4; h++ {
+		want := 2 * intervalZ * math.Sqrt(3) * math.Sqrt(float64(h))
+		if math.Abs(width(f, h)-want) > 1e-9 {
+			t.Errorf("naive %d ahead: got width %v, want %v", h, width(f, h), want)
+		}
+	}
+
+	// Seasonal naive: the width holds within a cycle and widens with each
+	// further cycle.
+	y := series(10)
+	y[8] += 3 // one residual of 3 over three seasonal differences
+	f = fitForecast(y, 7, 15)
+	one := 2 * intervalZ * math.Sqrt(3)
+	for h, cycles := range map[int]float64{1: 1, 7: 1, 8: 2, 14: 2, 15: 3} {
+		want := one * math.Sqrt(cycles)
+		if math.Abs(width(f, h)-want) > 1e-9 {
+			t.Errorf("seasonal naive %d ahead: got width %v, want %v", h, width(f, h), want)
+		}
+	}
+
+	// Holt-Winters: no error on an exact pattern, and widening intervals
+	// on a noisy one.
+	f = fitForecast(series(28), 7, 14)
+	for h := 1; h <= 14; h++ {
+		if width(f, h) > 1e-9 {
+			t.Errorf("holt-winters on an exact pattern %d ahead: got width %v, want 0", h, width(f, h))
+		}
+	}
+	y = series(28)
+	for t := range y {
+		y[t] += float64(t%3) * 2
+	}
+	f = fitForecast(y, 7, 14)
+	if f.Model != holtWintersModel {
+		t.Fatalf("got model %s, want %s", f.Model, holtWintersModel)
+	}
+	for h := 2; h <= 14; h++ {
+		if width(f, h) < width(f, h-1) {
+			t.Errorf("holt-winters %d ahead: width %v narrower than %v the period before", h, width(f, h), width(f, h-1))
+		}
+	}
+	if width(f, 1) <= 0 {
+		t.Errorf("holt-winters on a noisy pattern: got width %v, want > 0", width(f, 1))
+	}
+}
+
+// Forecasts of counts never go below zero.
+func TestFitForecastClamp(t *testing.T) {
+	f := fitForecast([]float64{50, 30, 10, 1}, 7, 3)
+	for h := range f.Point {
+		if f.Point[h] < 0 || f.Lower[h] < 0 || f.Upper[h] < 0 {
+			t.Errorf("%d ahead: got %v [%v, %v], want no negative values", h+1, f.Point[h], f.Lower[h], f.Upper[h])
+		}
+	}
+	if f.Lower[0] != 0 {
+		t.Errorf("got lower bound %v, want it clamped to 0", f.Lower[0])
+	}
+}
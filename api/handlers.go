@@ -0,0 +1,370 @@
+// Package api serves the reports over HTTP, along with the ingestion
+// status and geocode cache counters.
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/suebyeon/msds432_cbi/geo"
+	"github.com/suebyeon/msds432_cbi/ingest"
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+type TrafficCount struct {
+	PeriodStart   string `json:"period_start"`
+	NumberOfTrips int    `json:"number_of_trips"`
+}
+
+type TrafficForecastPoint struct {
+	PeriodStart   string  `json:"period_start"`
+	NumberOfTrips float64 `json:"number_of_trips"`
+	Lower95       float64 `json:"lower_95"`
+	Upper95       float64 `json:"upper_95"`
+}
+
+type TrafficForecast struct {
+	ZipCode   string                 `json:"zip_code"`
+	Direction string                 `json:"direction"`
+	Period    string                 `json:"period"`
+	Model     string                 `json:"model"`
+	History   []TrafficCount         `json:"history"`
+	Forecast  []TrafficForecastPoint `json:"forecast"`
+}
+
+// ReportNames are the reports, each served at GET /<name>.
+var ReportNames = []string{"req1", "req2", "req3", "req4", "req5", "req6"}
+
+// reportFuncs query each report from its query parameters. They return
+// the rows, a slice of report structs, with the page they are and the row
+// count of the whole report, and report malformed parameters as a
+// paramError.
+var reportFuncs = map[string]func(store.ReportStore, url.Values) (interface{}, reportMeta, error){
+	"req1": req1Report,
+	"req2": req2Report,
+	"req3": req3Report,
+	"req4": req4Report,
+	"req5": req5Report,
+	"req6": req6Report,
+}
+
+// NewServeMux routes the service's endpoints. Reports are read from
+// reports and ingestion runs from db. geocodeCache is nil when zip codes
+// are resolved offline.
+func NewServeMux(db *sql.DB, reports store.ReportStore, geocodeCache *geo.CachingResolver) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler)
+	for _, name := range ReportNames {
+		mux.Handle("/"+name, reportHandler(reports, name))
+	}
+	mux.Handle("/status", statusHandler(db))
+	mux.Handle("/geocode/stats", geocodeStatsHandler(geocodeCache))
+	return mux
+}
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	name := os.Getenv("PROJECT_ID")
+	if name == "" {
+		name = "CBI-Project"
+	}
+
+	fmt.Fprintf(w, "CBI data collection microservices' goroutines have started for %s!\n", name)
+}
+
+// req1Report reports trips from the airports by destination zip code. The
+// optional period parameter is "day" (the default) or "week"; airport_zips
+// replaces the O'Hare and Midway zip codes; from and to limit the trip start
+// dates.
+func req1Report(reports store.ReportStore, query url.Values) (interface{}, reportMeta, error) {
+	period, err := parseChoice(query, "period", "day", "day", "week")
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+	airportZips, err := parseZipList(query, "airport_zips", defaultAirportZipCodes)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+	dates, err := parseDateRange(query)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	page, err := parsePage(query, store.AirportTripSummary{})
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	summaries, total, err := reports.AirportTrips(store.AirportTripsQuery{Period: period, AirportZips: airportZips, Dates: dates, Page: page.Page})
+	if err != nil {
+		return nil, reportMeta{}, err
+	}
+	return summaries, reportMeta{Page: page, Total: total}, nil
+}
+
+// req4Report reports trip counts and forecasts per pickup and dropoff zip
+// code. period is "day", "week" (the default) or "month"; zip limits the
+// report to one zip code; horizon is how many periods to forecast; from and
+// to limit the history.
+func req4Report(reports store.ReportStore, query url.Values) (interface{}, reportMeta, error) {
+	period, err := parseChoice(query, "period", "week", "day", "week", "month")
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+	horizon, err := parseInt(query, "horizon", forecastPeriods[period].Horizon, 1, 366)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	var zip sql.NullString
+	if v := query.Get("zip"); v != "" {
+		if !isZipCode(v) {
+			return nil, reportMeta{}, paramError{errors.New("zip must be a 5 digit zip code")}
+		}
+		zip = sql.NullString{String: v, Valid: true}
+	}
+
+	dates, err := parseDateRange(query)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	forecasts, err := req4(reports, period, horizon, zip, dates)
+	if err != nil {
+		return nil, reportMeta{}, err
+	}
+	return forecasts, reportMeta{Total: len(forecasts)}, nil
+}
+
+// req2Report reports trips from the airports and COVID cases by destination
+// zip code. airport_zips replaces the O'Hare and Midway zip codes; from and
+// to limit the trip start dates.
+func req2Report(reports store.ReportStore, query url.Values) (interface{}, reportMeta, error) {
+	airportZips, err := parseZipList(query, "airport_zips", defaultAirportZipCodes)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+	dates, err := parseDateRange(query)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	page, err := parsePage(query, store.TripSummary{})
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	summaries, total, err := reports.CovidTrips(store.CovidTripsQuery{AirportZips: airportZips, Dates: dates, Page: page.Page})
+	if err != nil {
+		return nil, reportMeta{}, err
+	}
+	return summaries, reportMeta{Page: page, Total: total}, nil
+}
+
+// req3Report reports trips to and from the community areas in a CCVI
+// category. ccvi_category is HIGH (the default), MEDIUM or LOW; from and to
+// limit the trip start dates.
+func req3Report(reports store.ReportStore, query url.Values) (interface{}, reportMeta, error) {
+	category, err := parseChoice(query, "ccvi_category", "HIGH", "HIGH", "MEDIUM", "LOW")
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+	dates, err := parseDateRange(query)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	page, err := parsePage(query, store.CCVITripSummary{})
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	summaries, total, err := reports.CCVITrips(store.CCVITripsQuery{Category: category, Dates: dates, Page: page.Page})
+	if err != nil {
+		return nil, reportMeta{}, err
+	}
+	return summaries, reportMeta{Page: page, Total: total}, nil
+}
+
+// req5Report reports the community areas with the highest unemployment.
+// limit is how many to return (5 by default); from and to limit the permit
+// issue dates.
+func req5Report(reports store.ReportStore, query url.Values) (interface{}, reportMeta, error) {
+	limit, err := parseInt(query, "limit", 5, 1, 100)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+	dates, err := parseDateRange(query)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	page, err := parsePage(query, store.UnemployNeighborhoodSummary{})
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	summaries, total, err := reports.UnemployedAreas(store.UnemploymentQuery{Limit: limit, Dates: dates, Page: page.Page})
+	if err != nil {
+		return nil, reportMeta{}, err
+	}
+	return summaries, reportMeta{Page: page, Total: total}, nil
+}
+
+// req6Report reports the low-income community areas with the fewest
+// permits of a type. permit_type defaults to new construction and
+// per_capita_income_below to 30000; limit is how many to return (5 by
+// default); from and to limit the permit issue dates.
+func req6Report(reports store.ReportStore, query url.Values) (interface{}, reportMeta, error) {
+	permitType, err := parseText(query, "permit_type", "PERMIT - NEW CONSTRUCTION")
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+	incomeBelow, err := parseInt(query, "per_capita_income_below", 30000, 0, 10000000)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+	limit, err := parseInt(query, "limit", 5, 1, 100)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+	dates, err := parseDateRange(query)
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	page, err := parsePage(query, store.LoanNeighborhoodSummary{})
+	if err != nil {
+		return nil, reportMeta{}, paramError{err}
+	}
+
+	summaries, total, err := reports.PermitAreas(store.PermitQuery{PermitType: permitType, IncomeBelow: incomeBelow, Limit: limit, Dates: dates, Page: page.Page})
+	if err != nil {
+		return nil, reportMeta{}, err
+	}
+	return summaries, reportMeta{Page: page, Total: total}, nil
+}
+
+// req4 counts trips per pickup and per dropoff zip code in each day, week or
+// month of the trip start in Chicago time, and forecasts horizon periods
+// ahead of the latest one. Every series covers the same periods, with zero
+// counts where a zip code had no trips.
+func req4(reports store.ReportStore, period string, horizon int, zip sql.NullString, dates store.DateRange) ([]TrafficForecast, error) {
+	periodCounts, err := reports.TripPeriods(store.TripPeriodsQuery{Period: period, ZipCode: zip, Dates: dates})
+	if err != nil {
+		return nil, err
+	}
+
+	type seriesKey struct{ zip, direction string }
+	var keys []seriesKey
+	counts := map[seriesKey]map[string]int{}
+	var first, last string
+	for _, c := range periodCounts {
+		key := seriesKey{zip: c.ZipCode, direction: c.Direction}
+		if counts[key] == nil {
+			counts[key] = map[string]int{}
+			keys = append(keys, key)
+		}
+		counts[key][c.PeriodStart] = c.NumberOfTrips
+		if first == "" || c.PeriodStart < first {
+			first = c.PeriodStart
+		}
+		if c.PeriodStart > last {
+			last = c.PeriodStart
+		}
+	}
+
+	forecasts := []TrafficForecast{}
+	if len(keys) == 0 {
+		return forecasts, nil
+	}
+
+	fp := forecastPeriods[period]
+	var periods []string
+	start, err := time.Parse(store.DateLayout, first)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse(store.DateLayout, last)
+	if err != nil {
+		return nil, err
+	}
+	for t := start; !t.After(end); t = fp.next(t) {
+		periods = append(periods, t.Format(store.DateLayout))
+	}
+	var ahead []string
+	for t, h := fp.next(end), 0; h < horizon; t, h = fp.next(t), h+1 {
+		ahead = append(ahead, t.Format(store.DateLayout))
+	}
+
+	for _, key := range keys {
+		history := make([]TrafficCount, len(periods))
+		y := make([]float64, len(periods))
+		for i, p := range periods {
+			n := counts[key][p]
+			history[i] = TrafficCount{PeriodStart: p, NumberOfTrips: n}
+			y[i] = float64(n)
+		}
+
+		f := fitForecast(y, fp.Season, horizon)
+		points := make([]TrafficForecastPoint, horizon)
+		for h := range points {
+			points[h] = TrafficForecastPoint{
+				PeriodStart:   ahead[h],
+				NumberOfTrips: f.Point[h],
+				Lower95:       f.Lower[h],
+				Upper95:       f.Upper[h],
+			}
+		}
+
+		forecasts = append(forecasts, TrafficForecast{
+			ZipCode:   key.zip,
+			Direction: key.direction,
+			Period:    period,
+			Model:     f.Model,
+			History:   history,
+			Forecast:  points,
+		})
+	}
+	return forecasts, nil
+}
+
+func statusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		runs, err := ingest.LatestRuns(db)
+		if err != nil {
+			log.Printf("status error: %v", err)
+			http.Error(w, "Failed to retrieve ingestion status", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runs)
+	}
+}
+
+// geocodeStatsHandler serves the cache counters. cache is nil when zip
+// codes are resolved offline and nothing is cached.
+func geocodeStatsHandler(cache *geo.CachingResolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cache == nil {
+			http.Error(w, "Geocode cache is not in use", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cache.Stats())
+	}
+}
+
+// setAsOfHeader reports the as-of time of a report as its Last-Modified
+// time, for clients that read bare arrays.
+func setAsOfHeader(header http.Header, asOf *time.Time) {
+	if asOf != nil {
+		header.Set("Last-Modified", asOf.UTC().Format(http.TimeFormat))
+	}
+}
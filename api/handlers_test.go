@@ -0,0 +1,359 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// The handler tests serve the reports from a MemoryStore, and check that
+// an SQLStore over a SQLite database holding the same rows serves the
+// same responses.
+
+var (
+	nearNorthSide = json.RawMessage(`{"type":"Polygon","coordinates":[[[-87.63,41.89],[-87.62,41.89],[-87.62,41.90],[-87.63,41.89]]]}`)
+	loop          = json.RawMessage(`{"type":"Polygon","coordinates":[[[-87.64,41.87],[-87.62,41.87],[-87.62,41.88],[-87.64,41.87]]]}`)
+	austin        = json.RawMessage(`{"type":"Polygon","coordinates":[[[-87.79,41.88],[-87.74,41.88],[-87.74,41.91],[-87.79,41.88]]]}`)
+)
+
+// refreshedAt is when every summary of the test stores was last refreshed.
+var refreshedAt = time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func memoryStore() *store.MemoryStore {
+	return &store.MemoryStore{
+		TripCounts: []store.TripCountRow{
+			{PickupZipCode: "60666", DropoffZipCode: "60611", TripDate: "2023-01-02", NumberOfTrips: 3},
+			{PickupZipCode: "60666", DropoffZipCode: "60601", TripDate: "2023-01-02", NumberOfTrips: 3},
+			{PickupZipCode: "60638", DropoffZipCode: "60611", TripDate: "2023-01-03", NumberOfTrips: 2},
+			{PickupZipCode: "60611", DropoffZipCode: "60601", TripDate: "2023-01-03", NumberOfTrips: 5},
+			{PickupZipCode: "60601", DropoffZipCode: "60611", TripDate: "2023-01-04", NumberOfTrips: 2},
+			{PickupZipCode: "", DropoffZipCode: "60601", TripDate: "2023-01-05", NumberOfTrips: 1},
+			{PickupZipCode: "60666", DropoffZipCode: "60621", TripDate: "2023-01-09", NumberOfTrips: 1},
+			{PickupZipCode: "60666", DropoffZipCode: "", TripDate: "2023-01-09", NumberOfTrips: 4},
+			{PickupZipCode: "60621", DropoffZipCode: "60644", TripDate: "2023-02-01", NumberOfTrips: 1},
+			{PickupZipCode: "60666", DropoffZipCode: "60644", TripDate: "2023-02-01", NumberOfTrips: 2},
+			{PickupZipCode: "60644", DropoffZipCode: "60621", TripDate: "2023-02-06", NumberOfTrips: 2},
+		},
+		PermitCounts: []store.PermitCountRow{
+			{CommunityArea: 25, PermitType: "PERMIT - NEW CONSTRUCTION", IssueDate: "2023-01-05", NumberOfPermits: 2},
+			{CommunityArea: 25, PermitType: "PERMIT - RENOVATION/ALTERATION", IssueDate: "2023-02-01", NumberOfPermits: 1},
+			{CommunityArea: 68, PermitType: "PERMIT - NEW CONSTRUCTION", IssueDate: "2023-01-10", NumberOfPermits: 1},
+			{CommunityArea: 68, PermitType: "PERMIT - NEW CONSTRUCTION", IssueDate: "2023-01-11", NumberOfPermits: 1},
+			{CommunityArea: 44, PermitType: "PERMIT - NEW CONSTRUCTION", IssueDate: "2023-03-01", NumberOfPermits: 2},
+			{CommunityArea: 8, PermitType: "PERMIT - NEW CONSTRUCTION", IssueDate: "2023-01-20", NumberOfPermits: 1},
+			{CommunityArea: 3, PermitType: "PERMIT - RENOVATION/ALTERATION", IssueDate: "2023-01-02", NumberOfPermits: 4},
+		},
+		Covid: []store.CovidRow{
+			{ZipCode: "60601", Tests: 100, PercentagePositive: 0.25},
+			{ZipCode: "60601", Tests: 100, PercentagePositive: 0.5},
+			{ZipCode: "60611", Tests: 40, PercentagePositive: 0.125},
+			{ZipCode: "60644", Tests: 8, PercentagePositive: 0.5},
+		},
+		CCVI: []store.CCVIRow{
+			{CommunityAreaOrZip: 8, GeographyType: "CA", CommunityAreaName: "Near North Side", CcviCategory: "HIGH"},
+			{CommunityAreaOrZip: 32, GeographyType: "CA", CommunityAreaName: "Loop", CcviCategory: "HIGH"},
+			{CommunityAreaOrZip: 68, GeographyType: "CA", CommunityAreaName: "Englewood", CcviCategory: "HIGH"},
+			{CommunityAreaOrZip: 25, GeographyType: "CA", CommunityAreaName: "Austin", CcviCategory: "MEDIUM"},
+		},
+		Boundaries: []store.BoundaryRow{
+			{CommunityArea: "8", ZipCode: "60611", Geometry: nearNorthSide},
+			{CommunityArea: "32", ZipCode: "60601", Geometry: loop},
+			{CommunityArea: "68", ZipCode: "60621", Geometry: nil},
+			{CommunityArea: "25", ZipCode: "60644", Geometry: austin},
+		},
+		CommunityAreas: []store.CommunityAreaRow{
+			{CommunityArea: "8", Community: "NEAR NORTH SIDE", Geometry: nearNorthSide},
+			{CommunityArea: "32", Community: "LOOP", Geometry: loop},
+			{CommunityArea: "68", Community: "ENGLEWOOD", Geometry: nil},
+			{CommunityArea: "25", Community: "AUSTIN", Geometry: austin},
+		},
+		Unemployment: []store.UnemploymentRow{
+			{CommunityArea: "8", BelowPovertyLevel: 11.3, PerCapitaIncome: 71551, Unemployment: 6.5},
+			{CommunityArea: "25", BelowPovertyLevel: 28.6, PerCapitaIncome: 15957, Unemployment: 22},
+			{CommunityArea: "32", BelowPovertyLevel: 14.7, PerCapitaIncome: 65526, Unemployment: 5.7},
+			{CommunityArea: "68", BelowPovertyLevel: 46.6, PerCapitaIncome: 11888, Unemployment: 28},
+			{CommunityArea: "3", BelowPovertyLevel: 20, PerCapitaIncome: 30000, Unemployment: 22},
+			{CommunityArea: "44", BelowPovertyLevel: 28.6, PerCapitaIncome: 20000, Unemployment: 22},
+		},
+		Refreshed: map[string]time.Time{
+			store.TripCounts.Name:   refreshedAt,
+			store.PermitCounts.Name: refreshedAt,
+			store.CovidCases.Name:   refreshedAt,
+			store.CCVIZipCodes.Name: refreshedAt,
+			store.Unemployment.Name: refreshedAt,
+		},
+	}
+}
+
+// sqlStore loads the tables of mem into a new SQLite database and returns
+// an SQLStore over it, with every summary refreshed at refreshedAt.
+func sqlStore(t *testing.T, mem *store.MemoryStore) store.ReportStore {
+	db, err := store.Open(store.Config{Driver: store.SQLiteDriver, Path: filepath.Join(t.TempDir(), "cbi.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := store.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+
+	null := func(v string) interface{} {
+		if v == "" {
+			return nil
+		}
+		return v
+	}
+	exec := func(query string, args ...interface{}) {
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	for _, r := range mem.TripCounts {
+		exec(`INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips") VALUES ($1, $2, $3, $4)`,
+			null(r.PickupZipCode), null(r.DropoffZipCode), r.TripDate, r.NumberOfTrips)
+	}
+	for _, r := range mem.PermitCounts {
+		exec(`INSERT INTO permit_counts ("community_area", "permit_type", "issue_date", "number_of_permits") VALUES ($1, $2, $3, $4)`,
+			r.CommunityArea, r.PermitType, r.IssueDate, r.NumberOfPermits)
+	}
+	for i, r := range mem.Covid {
+		exec(`INSERT INTO covid ("zip_code", "week_number", "tests", "percentage_positive") VALUES ($1, $2, $3, $4)`,
+			null(r.ZipCode), i, r.Tests, r.PercentagePositive)
+	}
+	for _, r := range mem.CCVI {
+		exec(`INSERT INTO ccvi ("community_area_or_zip", "geography_type", "community_area_name", "ccvi_category") VALUES ($1, $2, $3, $4)`,
+			r.CommunityAreaOrZip, r.GeographyType, r.CommunityAreaName, r.CcviCategory)
+	}
+	for _, r := range mem.Boundaries {
+		exec(`INSERT INTO boundaries ("community_area", "zip_code", "the_geom") VALUES ($1, $2, $3)`,
+			r.CommunityArea, r.ZipCode, store.GeometryText(r.Geometry))
+	}
+	for _, r := range mem.CommunityAreas {
+		exec(`INSERT INTO community_areas ("community_area", "community", "the_geom") VALUES ($1, $2, $3)`,
+			r.CommunityArea, r.Community, store.GeometryText(r.Geometry))
+	}
+	for _, r := range mem.Unemployment {
+		exec(`INSERT INTO unemployment ("community_area", "below_poverty_level", "per_capita_income", "unemployment") VALUES ($1, $2, $3, $4)`,
+			r.CommunityArea, r.BelowPovertyLevel, r.PerCapitaIncome, r.Unemployment)
+	}
+
+	for _, summary := range []store.SummaryTable{store.CovidCases, store.CCVIZipCodes} {
+		if err := summary.Refresh(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name := range mem.Refreshed {
+		exec(`INSERT INTO report_refreshes ("summary", "refreshed_at") VALUES ($1, $2)
+			ON CONFLICT ("summary") DO UPDATE SET "refreshed_at" = EXCLUDED."refreshed_at"`, name, refreshedAt.Format("2006-01-02 15:04:05"))
+	}
+	return store.NewSQLStore(db)
+}
+
+func serve(reports store.ReportStore, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	NewServeMux(nil, reports, nil).ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return w
+}
+
+func TestMemoryStoreReports(t *testing.T) {
+	reports := memoryStore()
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/req1?format=csv", "airport,pickup_zip_code,period_start,dropoff_zip_code,number_of_trips\n" +
+			"O'Hare,60666,2023-01-02,60601,3\n" +
+			"O'Hare,60666,2023-01-02,60611,3\n" +
+			"Midway,60638,2023-01-03,60611,2\n" +
+			"O'Hare,60666,2023-01-09,60621,1\n" +
+			"O'Hare,60666,2023-02-01,60644,2\n"},
+		{"/req1?period=week&airport_zips=60666&format=csv", "airport,pickup_zip_code,period_start,dropoff_zip_code,number_of_trips\n" +
+			"O'Hare,60666,2023-01-02,60601,3\n" +
+			"O'Hare,60666,2023-01-02,60611,3\n" +
+			"O'Hare,60666,2023-01-09,60621,1\n" +
+			"O'Hare,60666,2023-01-30,60644,2\n"},
+
+		// Rows that tie on the sort field keep their natural order, in
+		// either direction.
+		{"/req1?sort=-number_of_trips&format=csv", "airport,pickup_zip_code,period_start,dropoff_zip_code,number_of_trips\n" +
+			"O'Hare,60666,2023-01-02,60601,3\n" +
+			"O'Hare,60666,2023-01-02,60611,3\n" +
+			"Midway,60638,2023-01-03,60611,2\n" +
+			"O'Hare,60666,2023-02-01,60644,2\n" +
+			"O'Hare,60666,2023-01-09,60621,1\n"},
+		{"/req1?sort=number_of_trips&page_size=2&page=2&envelope=false", `[{"airport":"O'Hare","pickup_zip_code":"60666","period_start":"2023-02-01","dropoff_zip_code":"60644","number_of_trips":2},` +
+			`{"airport":"O'Hare","pickup_zip_code":"60666","period_start":"2023-01-02","dropoff_zip_code":"60601","number_of_trips":3}]` + "\n"},
+
+		{"/req2", `[{"dropoff_zip_code":"60601","number_of_trips":3,"total_pos_cases":75},` +
+			`{"dropoff_zip_code":"60611","number_of_trips":5,"total_pos_cases":5},` +
+			`{"dropoff_zip_code":"60644","number_of_trips":2,"total_pos_cases":4}]` + "\n"},
+		{"/req2?from=2023-02-02", "[]\n"},
+		{"/req2?sort=-total_pos_cases&format=csv", "dropoff_zip_code,number_of_trips,total_pos_cases\n60601,3,75\n60611,5,5\n60644,2,4\n"},
+
+		// Community areas sort as numbers.
+		{"/req3?format=csv", "neighborhood_zip_code,community_area_name,number_of_trips_to,number_of_trips_from\n" +
+			"8,Near North Side,5,7\n" +
+			"32,Loop,2,9\n" +
+			"68,Englewood,1,3\n"},
+		{"/req3?sort=-neighborhood_zip_code&format=csv", "neighborhood_zip_code,community_area_name,number_of_trips_to,number_of_trips_from\n" +
+			"68,Englewood,1,3\n" +
+			"32,Loop,2,9\n" +
+			"8,Near North Side,5,7\n"},
+		{"/req3?ccvi_category=MEDIUM&format=csv", "neighborhood_zip_code,community_area_name,number_of_trips_to,number_of_trips_from\n" +
+			"25,Austin,2,3\n"},
+
+		// Areas 25 and 44 tie on both rates and sort by community area.
+		{"/req5?format=csv", "community_area,unemployment,below_poverty_level\n" +
+			"68,28,46.6\n" +
+			"25,22,28.6\n" +
+			"44,22,28.6\n" +
+			"3,22,20\n" +
+			"8,6.5,11.3\n"},
+		{"/req5?limit=3&page_size=2&page=2&format=csv", "community_area,unemployment,below_poverty_level\n" +
+			"44,22,28.6\n"},
+		{"/req5?to=2023-01-31&sort=community_area&format=csv", "community_area,unemployment,below_poverty_level\n" +
+			"25,22,28.6\n" +
+			"3,22,20\n" +
+			"68,28,46.6\n" +
+			"8,6.5,11.3\n"},
+
+		{"/req6?format=csv", "community_area,permit_count,per_capita_income\n" +
+			"25,2,15957\n" +
+			"44,2,20000\n" +
+			"68,2,11888\n"},
+		{"/req6?permit_type=PERMIT+-+RENOVATION%2FALTERATION&per_capita_income_below=40000&format=csv", "community_area,permit_count,per_capita_income\n" +
+			"25,1,15957\n" +
+			"3,4,30000\n"},
+		{"/req6?sort=-per_capita_income&limit=2&format=csv", "community_area,permit_count,per_capita_income\n" +
+			"44,2,20000\n" +
+			"25,2,15957\n"},
+
+		{"/req3?format=geojson", `{"type":"FeatureCollection","features":[` +
+			`{"type":"Feature","geometry":` + string(nearNorthSide) + `,"properties":{"neighborhood_zip_code":"8","community_area_name":"Near North Side","number_of_trips_to":5,"number_of_trips_from":7}},` +
+			`{"type":"Feature","geometry":` + string(loop) + `,"properties":{"neighborhood_zip_code":"32","community_area_name":"Loop","number_of_trips_to":2,"number_of_trips_from":9}},` +
+			`{"type":"Feature","geometry":null,"properties":{"neighborhood_zip_code":"68","community_area_name":"Englewood","number_of_trips_to":1,"number_of_trips_from":3}}]}` + "\n"},
+		{"/req6?sort=-community_area&page_size=1&format=geojson", `{"type":"FeatureCollection","features":[` +
+			`{"type":"Feature","geometry":null,"properties":{"community_area":"68","permit_count":2,"per_capita_income":11888}}]}` + "\n"},
+	}
+	for _, tt := range tests {
+		w := serve(reports, tt.target)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got status %d: %s", tt.target, w.Code, w.Body)
+			continue
+		}
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryStorePaging(t *testing.T) {
+	w := serve(memoryStore(), "/req5?sort=-community_area&page_size=2&page=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("got X-Total-Count %q, want 5", got)
+	}
+	if got, want := w.Header().Get("Last-Modified"), refreshedAt.Format(http.TimeFormat); got != want {
+		t.Errorf("got Last-Modified %q, want %q", got, want)
+	}
+
+	var envelope struct {
+		Data  []store.UnemployNeighborhoodSummary
+		Total int
+		Page  pageMeta
+		AsOf  time.Time `json:"as_of"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	wantData := []store.UnemployNeighborhoodSummary{
+		{CommunityArea: "44", Unemployment: 22, BelowPovertyLevel: 28.6},
+		{CommunityArea: "3", Unemployment: 22, BelowPovertyLevel: 20},
+	}
+	if fmt.Sprint(envelope.Data) != fmt.Sprint(wantData) {
+		t.Errorf("got data %v, want %v", envelope.Data, wantData)
+	}
+	wantPage := pageMeta{Number: 2, Size: 2, Pages: 3, Sort: "-community_area"}
+	if envelope.Total != 5 || envelope.Page != wantPage || !envelope.AsOf.Equal(refreshedAt) {
+		t.Errorf("got total %d, page %+v, as of %v; want 5, %+v, %v", envelope.Total, envelope.Page, envelope.AsOf, wantPage, refreshedAt)
+	}
+
+	for _, target := range []string{"/req1?sort=airport_name", "/req2?page=0", "/req3?page_size=1001", "/req6?format=xml"} {
+		if w := serve(memoryStore(), target); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// generatedAt matches the one field of a response that differs from one
+// request to the next.
+var generatedAt = regexp.MustCompile(`"generated_at":"[^"]*"`)
+
+// TestMemoryStoreMatchesSQLStore serves every report sorted on each of its
+// fields, in both directions, paged and in each format, from both stores.
+func TestMemoryStoreMatchesSQLStore(t *testing.T) {
+	mem := memoryStore()
+	sql := sqlStore(t, mem)
+
+	reports := []struct {
+		path    string
+		row     interface{}
+		queries []string
+	}{
+		{"/req1", store.AirportTripSummary{}, []string{"", "period=week", "airport_zips=60666", "from=2023-01-03&to=2023-01-31"}},
+		{"/req2", store.TripSummary{}, []string{"", "airport_zips=60611,60644", "to=2023-01-02", "from=2023-03-01"}},
+		{"/req3", store.CCVITripSummary{}, []string{"", "ccvi_category=MEDIUM", "ccvi_category=LOW", "from=2023-01-04"}},
+		{"/req5", store.UnemployNeighborhoodSummary{}, []string{"", "limit=2", "from=2023-01-06&to=2023-02-28"}},
+		{"/req6", store.LoanNeighborhoodSummary{}, []string{"", "per_capita_income_below=100000", "permit_type=PERMIT+-+RENOVATION%2FALTERATION&per_capita_income_below=40000", "limit=2"}},
+	}
+	var targets []string
+	for _, report := range reports {
+		var sorts []string
+		for _, f := range reportFields(reflect.TypeOf(report.row)) {
+			sorts = append(sorts, "sort="+f.name, "sort=-"+f.name)
+		}
+		for _, query := range report.queries {
+			for _, format := range []string{"json", "csv", "geojson", "parquet"} {
+				targets = append(targets, fmt.Sprintf("%s?%s&format=%s", report.path, query, format))
+			}
+			for _, sort := range sorts {
+				targets = append(targets, fmt.Sprintf("%s?%s&%s", report.path, query, sort))
+				for page := 1; page <= 3; page++ {
+					targets = append(targets, fmt.Sprintf("%s?%s&%s&page_size=2&page=%d", report.path, query, sort, page))
+				}
+			}
+		}
+	}
+	targets = append(targets,
+		"/req4?period=day", "/req4?period=week&horizon=3", "/req4?period=month&horizon=2",
+		"/req4?zip=60611&period=day&from=2023-01-02&to=2023-01-09", "/req4?zip=60000")
+
+	for _, target := range targets {
+		want, got := serve(mem, target), serve(sql, target)
+		if got.Code != http.StatusOK || want.Code != http.StatusOK {
+			t.Errorf("%s: got status %d from SQLStore, %d from MemoryStore: %s%s", target, got.Code, want.Code, got.Body, want.Body)
+			continue
+		}
+		for _, header := range []string{"Content-Type", "X-Total-Count", "Last-Modified"} {
+			if got.Header().Get(header) != want.Header().Get(header) {
+				t.Errorf("%s: got %s %q from SQLStore, %q from MemoryStore", target, header, got.Header().Get(header), want.Header().Get(header))
+			}
+		}
+		gotBody := generatedAt.ReplaceAll(got.Body.Bytes(), nil)
+		wantBody := generatedAt.ReplaceAll(want.Body.Bytes(), nil)
+		if string(gotBody) != string(wantBody) {
+			t.Errorf("%s: got\n%s\nfrom SQLStore, and\n%s\nfrom MemoryStore", target, gotBody, wantBody)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// maxPageSize bounds the page_size parameter.
+const maxPageSize = 1000
+
+// pageRequest is the sorting and paging asked for with the sort, page,
+// page_size and envelope parameters. Reports without any of them are
+// returned whole, as a bare array, in their natural order.
+type pageRequest struct {
+	store.Page
+
+	// Envelope wraps JSON responses in a reportEnvelope.
+	Envelope bool
+}
+
+// parsePage reads the paging parameters. sort names a field of row, the
+// report's row struct, prefixed with "-" to sort descending. Asking for a
+// page or page size turns on the envelope.
+func parsePage(query url.Values, row interface{}) (pageRequest, error) {
+	page := pageRequest{Page: store.Page{Number: 1}}
+
+	if v := query.Get("sort"); v != "" {
+		field := strings.TrimPrefix(v, "-")
+		page.Desc = field != v
+		for _, f := range reportFields(reflect.TypeOf(row)) {
+			if f.name == field {
+				page.Sort = field
+			}
+		}
+		if page.Sort == "" {
+			return page, fmt.Errorf("sort must name an output field, got %q", v)
+		}
+	}
+
+	var err error
+	if page.Number, err = parseInt(query, "page", 1, 1, 1<<30); err != nil {
+		return page, err
+	}
+	if page.Size, err = parseInt(query, "page_size", 0, 1, maxPageSize); err != nil {
+		return page, err
+	}
+	if query.Get("page") != "" && page.Size == 0 {
+		page.Size = 100
+	}
+
+	switch v := query.Get("envelope"); v {
+	case "":
+		page.Envelope = page.Size > 0
+	case "1", "true":
+		page.Envelope = true
+	case "0", "false":
+	default:
+		return page, fmt.Errorf("envelope must be true or false, got %q", v)
+	}
+	return page, nil
+}
+
+// reportEnvelope wraps a page of a JSON report.
+type reportEnvelope struct {
+	Data        interface{} `json:"data"`
+	Total       int         `json:"total"`
+	Page        pageMeta    `json:"page"`
+	GeneratedAt time.Time   `json:"generated_at"`
+
+	// AsOf is the earliest time the tables the report was read from were
+	// last refreshed; null if any never has been.
+	AsOf *time.Time `json:"as_of"`
+}
+
+type pageMeta struct {
+	Number int    `json:"number"`
+	Size   int    `json:"size"`
+	Pages  int    `json:"pages"`
+	Sort   string `json:"sort,omitempty"`
+}
+
+func newReportEnvelope(rows interface{}, page pageRequest, total int, asOf *time.Time) reportEnvelope {
+	v := reflect.ValueOf(rows)
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		rows = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+	}
+
+	meta := pageMeta{Number: page.Number, Size: page.Size, Pages: 1}
+	if page.Size > 0 {
+		meta.Pages = (total + page.Size - 1) / page.Size
+	} else {
+		meta.Size = total
+	}
+	if page.Sort != "" {
+		meta.Sort = page.Sort
+		if page.Desc {
+			meta.Sort = "-" + page.Sort
+		}
+	}
+	return reportEnvelope{Data: rows, Total: total, Page: meta, GeneratedAt: time.Now().UTC(), AsOf: asOf}
+}
+
+// setPageHeaders reports the total on every response, whatever its format.
+func setPageHeaders(header http.Header, total int) {
+	header.Set("X-Total-Count", strconv.Itoa(total))
+}
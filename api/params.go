@@ -0,0 +1,117 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// isZipCode reports whether v is a 5 digit zip code.
+func isZipCode(v string) bool {
+	if len(v) != 5 {
+		return false
+	}
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDateRange reads the from and to query parameters.
+func parseDateRange(query url.Values) (store.DateRange, error) {
+	var dates store.DateRange
+	for _, p := range []struct {
+		name string
+		dst  *sql.NullString
+	}{{"from", &dates.From}, {"to", &dates.To}} {
+		v := query.Get(p.name)
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse(store.DateLayout, v); err != nil {
+			return dates, fmt.Errorf("%s must be a date like 2023-01-31, got %q", p.name, v)
+		}
+		*p.dst = sql.NullString{String: v, Valid: true}
+	}
+	if dates.From.Valid && dates.To.Valid && dates.From.String > dates.To.String {
+		return dates, fmt.Errorf("from (%s) is after to (%s)", dates.From.String, dates.To.String)
+	}
+	return dates, nil
+}
+
+// defaultAirportZipCodes are O'Hare and Midway.
+var defaultAirportZipCodes = []string{"60666", "60638"}
+
+// parseZipList reads a comma-separated list of zip codes, or returns def if
+// the parameter is absent.
+func parseZipList(query url.Values, name string, def []string) ([]string, error) {
+	v := query.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	var zips []string
+	for _, zip := range strings.Split(v, ",") {
+		zip = strings.TrimSpace(zip)
+		if !isZipCode(zip) {
+			return nil, fmt.Errorf("%s must be a comma-separated list of 5 digit zip codes, got %q", name, zip)
+		}
+		zips = append(zips, zip)
+	}
+	if len(zips) > maxListParam {
+		return nil, fmt.Errorf("%s may list at most %d zip codes", name, maxListParam)
+	}
+	return zips, nil
+}
+
+// maxListParam bounds list parameters, and so the number of SQL parameters
+// they expand to.
+const maxListParam = 50
+
+// parseInt reads an integer parameter between min and max, or returns def
+// if the parameter is absent.
+func parseInt(query url.Values, name string, def, min, max int) (int, error) {
+	v := query.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be an integer between %d and %d, got %q", name, min, max, v)
+	}
+	return n, nil
+}
+
+// parseChoice reads a parameter that must be one of choices, compared
+// without regard to case, or returns def if the parameter is absent.
+func parseChoice(query url.Values, name, def string, choices ...string) (string, error) {
+	v := query.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	for _, c := range choices {
+		if strings.EqualFold(v, c) {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("%s must be one of %s, got %q", name, strings.Join(choices, ", "), v)
+}
+
+// parseText reads a free-text parameter of at most 255 characters, or
+// returns def if the parameter is absent.
+func parseText(query url.Values, name, def string) (string, error) {
+	v := strings.TrimSpace(query.Get(name))
+	if v == "" {
+		return def, nil
+	}
+	if len(v) > 255 {
+		return "", fmt.Errorf("%s must be at most 255 characters", name)
+	}
+	return v, nil
+}
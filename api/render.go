@@ -0,0 +1,367 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suebyeon/msds432_cbi/store"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Report formats, chosen with ?format= or the Accept header.
+const (
+	jsonFormat    = "json"
+	csvFormat     = "csv"
+	geoJSONFormat = "geojson"
+	parquetFormat = "parquet"
+)
+
+var formatTypes = map[string]string{
+	jsonFormat:    "application/json",
+	csvFormat:     "text/csv",
+	geoJSONFormat: "application/geo+json",
+	parquetFormat: "application/vnd.apache.parquet",
+}
+
+// acceptTypes maps the media types understood in an Accept header to a
+// format, including common aliases.
+var acceptTypes = map[string]string{
+	"application/json":               jsonFormat,
+	"application/*":                  jsonFormat,
+	"*/*":                            jsonFormat,
+	"text/csv":                       csvFormat,
+	"application/geo+json":           geoJSONFormat,
+	"application/vnd.geo+json":       geoJSONFormat,
+	"application/vnd.apache.parquet": parquetFormat,
+	"application/x-parquet":          parquetFormat,
+}
+
+// negotiateFormat picks the response format. A format parameter wins;
+// otherwise the Accept header's most preferred known type is used, and JSON
+// if it names none.
+func negotiateFormat(r *http.Request) (string, error) {
+	if v := r.URL.Query().Get("format"); v != "" {
+		return parseFormat(v)
+	}
+
+	format, best := jsonFormat, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		f, ok := acceptTypes[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > best {
+			format, best = f, q
+		}
+	}
+	return format, nil
+}
+
+// parseFormat reads a format name, in any case.
+func parseFormat(v string) (string, error) {
+	format := strings.ToLower(v)
+	if _, ok := formatTypes[format]; !ok {
+		return "", fmt.Errorf("format must be one of json, csv, geojson or parquet, got %q", v)
+	}
+	return format, nil
+}
+
+// reportSources are the tables each report is read from.
+var reportSources = map[string][]store.SummaryTable{
+	"req1": {store.TripCounts},
+	"req2": {store.TripCounts, store.CovidCases},
+	"req3": {store.TripCounts, store.CCVIZipCodes},
+	"req4": {store.TripCounts},
+	"req5": {store.PermitCounts, store.Unemployment},
+	"req6": {store.PermitCounts, store.Unemployment},
+}
+
+// reportAsOf returns the as-of time of the named report: the earliest
+// refresh time of its sources, or nil if any has never been refreshed.
+func reportAsOf(reports store.ReportStore, name string) (*time.Time, error) {
+	var asOf *time.Time
+	for _, source := range reportSources[name] {
+		refreshed, err := reports.AsOf(source.Name)
+		if err != nil || refreshed == nil {
+			return nil, err
+		}
+		if asOf == nil || refreshed.Before(*asOf) {
+			asOf = refreshed
+		}
+	}
+	return asOf, nil
+}
+
+// reportMeta describes the rows a report func returns: the page they are
+// and the row count of the whole report.
+type reportMeta struct {
+	Page  pageRequest
+	Total int
+}
+
+// paramError is a malformed report parameter, the client's mistake.
+type paramError struct{ err error }
+
+func (e paramError) Error() string { return e.err.Error() }
+
+// A Report is a report rendered in one format, with the headers it is
+// served with.
+type Report struct {
+	Header http.Header
+	Body   []byte
+}
+
+// RenderReport queries the named report and renders it in format, one of
+// json, csv, geojson or parquet, exactly as GET /<name> serves it. query
+// holds the parameters the endpoint takes. req4's forecasts do not flatten
+// into rows, so it is always JSON.
+func RenderReport(reports store.ReportStore, name string, query url.Values, format string) (*Report, error) {
+	report, ok := reportFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown report %q, want one of %s", name, strings.Join(ReportNames, ", "))
+	}
+	format, err := parseFormat(format)
+	if err != nil {
+		return nil, paramError{err}
+	}
+	if name == "req4" {
+		format = jsonFormat
+	}
+
+	rows, meta, err := report(reports, query)
+	if err != nil {
+		return nil, err
+	}
+	asOf, err := reportAsOf(reports, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case jsonFormat:
+		if meta.Page.Envelope {
+			err = json.NewEncoder(&buf).Encode(newReportEnvelope(rows, meta.Page, meta.Total, asOf))
+		} else {
+			err = json.NewEncoder(&buf).Encode(rows)
+		}
+	case csvFormat:
+		err = writeCSV(&buf, rows)
+	case geoJSONFormat:
+		err = writeGeoJSON(&buf, reports, rows)
+	case parquetFormat:
+		err = writeParquet(&buf, rows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rendering %s as %s: %v", name, format, err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", formatTypes[format])
+	setPageHeaders(header, meta.Total)
+	setAsOfHeader(header, asOf)
+	if format == csvFormat || format == parquetFormat {
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	}
+	return &Report{Header: header, Body: buf.Bytes()}, nil
+}
+
+// reportHandler serves the named report in the negotiated format, with its
+// parameters from the query string. The report is rendered in memory first
+// so a rendering error can still be reported with an error status.
+func reportHandler(reports store.ReportStore, name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := negotiateFormat(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := RenderReport(reports, name, r.URL.Query(), format)
+		var bad paramError
+		if errors.As(err, &bad) {
+			http.Error(w, bad.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("%s error: %v", name, err)
+			http.Error(w, fmt.Sprintf("Failed to retrieve %s data", name), http.StatusInternalServerError)
+			return
+		}
+
+		for key, values := range report.Header {
+			w.Header()[key] = values
+		}
+		w.Write(report.Body)
+	}
+}
+
+// reportField is a column of a report, named by the struct's json tag.
+type reportField struct {
+	name  string
+	index int
+}
+
+func reportFields(t reflect.Type) []reportField {
+	var fields []reportField
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, reportField{name: name, index: i})
+	}
+	return fields
+}
+
+// reportRows checks that rows is a slice of structs and returns it with
+// its element type.
+func reportRows(rows interface{}) (reflect.Value, reflect.Type, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return v, nil, fmt.Errorf("report rows must be a slice of structs, got %T", rows)
+	}
+	return v, v.Type().Elem(), nil
+}
+
+// writeCSV writes a header row of field names, then one row per record.
+func writeCSV(w io.Writer, rows interface{}) error {
+	v, t, err := reportRows(rows)
+	if err != nil {
+		return err
+	}
+	fields := reportFields(t)
+
+	cw := csv.NewWriter(w)
+	record := make([]string, len(fields))
+	for i, f := range fields {
+		record[i] = f.name
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		for j, f := range fields {
+			record[j] = csvValue(v.Index(i).Field(f.index))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// geoFeature is implemented by report rows that describe an area, so the
+// report can be exported as GeoJSON.
+type geoFeature interface {
+	Area() (kind, key string)
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties json.RawMessage `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// writeGeoJSON writes a FeatureCollection with one feature per row. Each
+// row's fields become the feature's properties and the outline of its zip
+// code or community area its geometry, which is null if none is stored.
+func writeGeoJSON(w io.Writer, reports store.ReportStore, rows interface{}) error {
+	v, _, err := reportRows(rows)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string][]string{}
+	for i := 0; i < v.Len(); i++ {
+		row, ok := v.Index(i).Interface().(geoFeature)
+		if !ok {
+			return fmt.Errorf("%T rows have no geometry", v.Index(i).Interface())
+		}
+		kind, key := row.Area()
+		keys[kind] = append(keys[kind], key)
+	}
+
+	geometries := map[string]map[string]json.RawMessage{}
+	for kind, list := range keys {
+		if geometries[kind], err = reports.Geometries(kind, list); err != nil {
+			return err
+		}
+	}
+
+	collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i).Interface()
+		properties, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		kind, key := row.(geoFeature).Area()
+		geometry := geometries[kind][key]
+		if geometry == nil {
+			geometry = json.RawMessage("null")
+		}
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geometry,
+			Properties: properties,
+		})
+	}
+	return json.NewEncoder(w).Encode(collection)
+}
+
+// writeParquet writes rows as a single Parquet row group. The row structs
+// describe their columns with parquet tags.
+func writeParquet(w io.Writer, rows interface{}) error {
+	v, t, err := reportRows(rows)
+	if err != nil {
+		return err
+	}
+
+	pw, err := writer.NewParquetWriterFromWriter(w, reflect.New(t).Interface(), 1)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := pw.Write(v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
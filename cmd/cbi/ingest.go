@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/suebyeon/msds432_cbi/config"
+	"github.com/suebyeon/msds432_cbi/ingest"
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// ingestAllJobs are the collectors `ingest all` runs, in dependency order.
+var ingestAllJobs = []string{
+	ingest.BoundariesJob,
+	ingest.CommunityAreasJob,
+	ingest.TripsJob,
+	ingest.UnemploymentJob,
+	ingest.PermitsJob,
+	ingest.CovidJob,
+	ingest.CCVIJob,
+}
+
+// runIngestCommand implements `ingest <job>|all [--since 2006-01-02]`.
+// --since reloads the trips, building permits and COVID datasets from that
+// date instead of from where the last load stopped.
+func runIngestCommand(cfg config.Config, db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ingest <job>|all [--since 2006-01-02]")
+	}
+	name := args[0]
+
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	since := flags.String("since", "", "load incremental datasets from this date (2006-01-02)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("ingest: unexpected argument %q", flags.Arg(0))
+	}
+
+	collector, _, err := newCollector(cfg, db)
+	if err != nil {
+		return err
+	}
+	if *since != "" {
+		day, err := time.Parse(store.DateLayout, *since)
+		if err != nil {
+			return fmt.Errorf("ingest: invalid --since %q, want YYYY-MM-DD", *since)
+		}
+		collector.Since = day.Format("2006-01-02T15:04:05.000")
+	}
+
+	jobs := []string{name}
+	if name == "all" {
+		jobs = ingestAllJobs
+	} else if _, ok := collector.Runs()[name]; !ok {
+		return fmt.Errorf("ingest: unknown job %q, want all or one of %s", name, strings.Join(jobNames(collector), ", "))
+	}
+
+	return runJobs(cfg, db, collector, jobs)
+}
+
+// runGeocodeCommand implements `geocode backfill`.
+func runGeocodeCommand(cfg config.Config, db *sql.DB, args []string) error {
+	if len(args) != 1 || args[0] != "backfill" {
+		return fmt.Errorf("usage: geocode backfill")
+	}
+
+	collector, _, err := newCollector(cfg, db)
+	if err != nil {
+		return err
+	}
+	return runJobs(cfg, db, collector, []string{ingest.GeocodeBackfillJob})
+}
+
+// runJobs runs each job once, in order, the way the scheduler runs it:
+// failed attempts are retried, the run is recorded in ingestion_runs and
+// the summaries it feeds are refreshed. A failed job does not stop the
+// ones after it.
+func runJobs(cfg config.Config, db *sql.DB, collector *ingest.Collector, names []string) error {
+	if err := applyMigrations(db); err != nil {
+		return err
+	}
+
+	retry, err := cfg.Retry.Policy()
+	if err != nil {
+		return err
+	}
+	scheduler := ingest.NewScheduler(db, retry)
+
+	runs := collector.Runs()
+	var failed []string
+	for _, name := range names {
+		job := ingest.Job{Name: name, Run: ingest.RefreshAfter(db, runs[name], ingest.SummariesFedBy[name])}
+		if err := scheduler.RunNow(job); err != nil {
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// jobNames returns the names of the collector's jobs, sorted.
+func jobNames(collector *ingest.Collector) []string {
+	var names []string
+	for name := range collector.Runs() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
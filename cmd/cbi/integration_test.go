@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/suebyeon/msds432_cbi/api"
+	"github.com/suebyeon/msds432_cbi/config"
+	"github.com/suebyeon/msds432_cbi/ingest"
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// The integration test loads the canned SODA responses in testdata/soda
+// through an httptest server, resolves zip codes with geo.GoogleResolver
+// against a fake geocoding server, and stores everything in a throwaway SQLite
+// database, then checks what was stored and what the reports serve.
+
+// fakeZipCodes maps the coordinates used in testdata/soda, to four decimal
+// places, to the zip code the fake geocoder answers with.
+var fakeZipCodes = map[string]string{
+	"41.9786,-87.9048": "60666", // O'Hare
+	"41.7868,-87.7522": "60638", // Midway
+	"41.8999,-87.6345": "60611", // Near North Side
+	"41.8842,-87.6324": "60601", // Loop
+	"41.8947,-87.7655": "60644", // Austin
+	"41.7794,-87.6446": "60621", // Englewood
+}
+
+// fakeNoPostalCode is a coordinate the fake geocoder finds an address for
+// without a postal code, and fakeOverQuota one it refuses with
+// OVER_QUERY_LIMIT until quotaRestored is set, then resolves to
+// fakeOverQuotaZip. Any coordinate not listed anywhere gets ZERO_RESULTS.
+const (
+	fakeNoPostalCode = "41.7600,-87.5500"
+	fakeOverQuota    = "41.8000,-87.6000"
+	fakeOverQuotaZip = "60653"
+)
+
+var quotaRestored int32
+
+// fakeGeocoder answers reverse geocoding requests the way the Google API
+// does.
+func fakeGeocoder(w http.ResponseWriter, r *http.Request) {
+	latlng := strings.Split(r.URL.Query().Get("latlng"), ",")
+	if len(latlng) != 2 {
+		http.Error(w, "bad latlng", http.StatusBadRequest)
+		return
+	}
+	lat, _ := strconv.ParseFloat(latlng[0], 64)
+	lon, _ := strconv.ParseFloat(latlng[1], 64)
+	key := fmt.Sprintf("%.4f,%.4f", lat, lon)
+
+	type component struct {
+		LongName  string   `json:"long_name"`
+		ShortName string   `json:"short_name"`
+		Types     []string `json:"types"`
+	}
+	type result struct {
+		AddressComponents []component `json:"address_components"`
+		FormattedAddress  string      `json:"formatted_address"`
+		Types             []string    `json:"types"`
+	}
+	response := struct {
+		Results []result `json:"results"`
+		Status  string   `json:"status"`
+	}{Results: []result{}, Status: "ZERO_RESULTS"}
+
+	city := component{LongName: "Chicago", ShortName: "Chicago", Types: []string{"locality", "political"}}
+	if zip, ok := fakeZipCodes[key]; ok {
+		response.Status = "OK"
+		response.Results = append(response.Results, result{
+			AddressComponents: []component{city, {LongName: zip, ShortName: zip, Types: []string{"postal_code"}}},
+			FormattedAddress:  "Chicago, IL " + zip + ", USA",
+			Types:             []string{"street_address"},
+		})
+	} else if key == fakeOverQuota && atomic.LoadInt32(&quotaRestored) == 0 {
+		response.Status = "OVER_QUERY_LIMIT"
+	} else if key == fakeOverQuota {
+		response.Status = "OK"
+		response.Results = append(response.Results, result{
+			AddressComponents: []component{city, {LongName: fakeOverQuotaZip, ShortName: fakeOverQuotaZip, Types: []string{"postal_code"}}},
+			FormattedAddress:  "Chicago, IL " + fakeOverQuotaZip + ", USA",
+			Types:             []string{"street_address"},
+		})
+	} else if key == fakeNoPostalCode {
+		response.Status = "OK"
+		response.Results = append(response.Results, result{
+			AddressComponents: []component{city},
+			FormattedAddress:  "Lake Michigan, Chicago, IL, USA",
+			Types:             []string{"natural_feature"},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// fakeSODA serves testdata/soda/<dataset>.json at /<dataset>.json, paged
+// with $limit and $offset.
+func fakeSODA(w http.ResponseWriter, r *http.Request) {
+	dataset := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".json")
+	body, err := (&ingest.FileSource{Dir: filepath.Join("testdata", "soda")}).Fetch(dataset, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// redirectTransport sends requests for host to target instead, so code
+// with a fixed API URL, like the geocoder package, can be pointed at a
+// test server.
+type redirectTransport struct {
+	host   string
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host == t.host {
+		r = r.Clone(r.Context())
+		r.URL.Scheme = t.target.Scheme
+		r.URL.Host = t.target.Host
+		r.Host = ""
+	}
+	return t.next.RoundTrip(r)
+}
+
+// testConfig points the SODA datasets and the Google geocoding API at fake
+// servers and the database at a throwaway SQLite file, for the rest of the
+// test. Small pages and batches make the collectors page through every
+// dataset and load in several batches.
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+
+	soda := httptest.NewServer(http.HandlerFunc(fakeSODA))
+	t.Cleanup(soda.Close)
+	geocoding := httptest.NewServer(http.HandlerFunc(fakeGeocoder))
+	t.Cleanup(geocoding.Close)
+
+	cfg := config.Default()
+	cfg.DB.Driver = store.SQLiteDriver
+	cfg.DB.Path = filepath.Join(t.TempDir(), "cbi.db")
+	cfg.DB.BatchSize = 2
+	cfg.Geocoder.RequestsPerSecond = 0
+	for name, ds := range cfg.SODA.Datasets {
+		ds.URL = soda.URL + "/" + name + ".json"
+		ds.PageSize = 2
+		cfg.SODA.Datasets[name] = ds
+	}
+
+	target, _ := url.Parse(geocoding.URL)
+	saved := http.DefaultTransport
+	http.DefaultTransport = redirectTransport{host: "maps.googleapis.com", target: target, next: saved}
+	t.Cleanup(func() { http.DefaultTransport = saved })
+
+	return cfg
+}
+
+func TestIngestAndReports(t *testing.T) {
+	cfg := testConfig(t)
+	db, err := store.Open(cfg.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := store.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+
+	collector, geocodeCache, err := newCollector(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := collector.Runs()
+
+	// Jobs run in dependency order and refresh the summaries they feed, as
+	// they do when scheduled.
+	jobs := []struct {
+		name  string
+		stats ingest.RunStats
+	}{
+		{ingest.BoundariesJob, ingest.RunStats{Fetched: 3, Inserted: 3, Skipped: map[string]int{}}},
+		{ingest.CommunityAreasJob, ingest.RunStats{Fetched: 3, Inserted: 2, Skipped: map[string]int{"missing_the_geom": 1}}},
+		{ingest.TripsJob, ingest.RunStats{Fetched: 12, Inserted: 8, Skipped: map[string]int{
+			"missing_trip_id":                    1,
+			"invalid_trip_end_timestamp":         1,
+			"missing_pickup_centroid_latitude":   1,
+			"invalid_dropoff_centroid_longitude": 1,
+		}}},
+		{ingest.UnemploymentJob, ingest.RunStats{Fetched: 6, Inserted: 4, Skipped: map[string]int{
+			"invalid_per_capita_income": 1,
+			"missing_community_area":    1,
+		}}},
+		{ingest.PermitsJob, ingest.RunStats{Fetched: 7, Inserted: 5, Skipped: map[string]int{
+			"missing_permit_type":    1,
+			"invalid_community_area": 1,
+		}}},
+		{ingest.CovidJob, ingest.RunStats{Fetched: 5, Inserted: 4, Skipped: map[string]int{"invalid_tests_weekly": 1}}},
+		{ingest.CCVIJob, ingest.RunStats{Fetched: 5, Inserted: 4, Skipped: map[string]int{"missing_ccvi_category": 1}}},
+
+		// Only the trips refused over quota are retried, including the one
+		// whose other coordinate has no result, and they are refused
+		// again; no_result and no_postal_code rows are final.
+		{ingest.GeocodeBackfillJob, ingest.RunStats{Fetched: 2, Inserted: 0, Skipped: map[string]int{"unresolved_failed": 2}}},
+	}
+	for _, job := range jobs {
+		stats, err := ingest.RefreshAfter(db, runs[job.name], ingest.SummariesFedBy[job.name])()
+		if err != nil {
+			t.Fatalf("%s: %v", job.name, err)
+		}
+		if !reflect.DeepEqual(stats, job.stats) {
+			t.Errorf("%s: got stats %+v, want %+v", job.name, stats, job.stats)
+		}
+	}
+
+	counts := []struct {
+		query string
+		want  map[string]int
+	}{
+		{`SELECT "resolution_status", COUNT(*) FROM transportation GROUP BY 1`, map[string]int{"resolved": 5, "no_result": 1, "failed": 2}},
+		{`SELECT "resolution_status", COUNT(*) FROM permit GROUP BY 1`, map[string]int{"resolved": 4, "no_postal_code": 1}},
+		{`SELECT "trip_date", SUM("number_of_trips") FROM trip_counts GROUP BY 1`, map[string]int{"2023-01-02": 5, "2023-01-03": 2, "2023-01-04": 1}},
+		{`SELECT "permit_type", SUM("number_of_permits") FROM permit_counts GROUP BY 1`, map[string]int{
+			"PERMIT - NEW CONSTRUCTION":      3,
+			"PERMIT - RENOVATION/ALTERATION": 2,
+		}},
+		{`SELECT "zip_code", COUNT(*) FROM covid_cases GROUP BY 1`, map[string]int{"60601": 1, "60611": 1, "60666": 1}},
+		{`SELECT "ccvi_category", COUNT(*) FROM ccvi_zip_codes GROUP BY 1`, map[string]int{"HIGH": 2}},
+		{`SELECT "dataset", COUNT(*) FROM ingest_watermarks GROUP BY 1`, map[string]int{
+			ingest.TaxiTripsDataset:       1,
+			ingest.TNPTripsDataset:        1,
+			ingest.BuildingPermitsDataset: 1,
+			ingest.CovidDataset:           1,
+		}},
+	}
+	for _, c := range counts {
+		if got := queryCounts(t, db, c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.query, got, c.want)
+		}
+	}
+
+	mux := api.NewServeMux(db, store.NewSQLStore(db), geocodeCache)
+	reports := []struct {
+		path string
+		want string
+	}{
+		{"/req2?sort=dropoff_zip_code",
+			`[{"dropoff_zip_code":"60601","number_of_trips":1,"total_pos_cases":5},` +
+				`{"dropoff_zip_code":"60611","number_of_trips":2,"total_pos_cases":125}]`},
+		// Pages without a sort follow the report's natural order.
+		{"/req2?page_size=1&page=1&envelope=false",
+			`[{"dropoff_zip_code":"60601","number_of_trips":1,"total_pos_cases":5}]`},
+		{"/req2?page_size=1&page=2&envelope=false",
+			`[{"dropoff_zip_code":"60611","number_of_trips":2,"total_pos_cases":125}]`},
+		{"/req3?page_size=1&page=1&envelope=false",
+			`[{"neighborhood_zip_code":"8","community_area_name":"Near North Side","number_of_trips_to":1,"number_of_trips_from":2}]`},
+		{"/req3?page_size=1&page=2&envelope=false",
+			`[{"neighborhood_zip_code":"32","community_area_name":"Loop","number_of_trips_to":1,"number_of_trips_from":3}]`},
+		{"/req3?sort=neighborhood_zip_code",
+			`[{"neighborhood_zip_code":"8","community_area_name":"Near North Side","number_of_trips_to":1,"number_of_trips_from":2},` +
+				`{"neighborhood_zip_code":"32","community_area_name":"Loop","number_of_trips_to":1,"number_of_trips_from":3}]`},
+		// Community areas 25 and 68 have two permits each and are listed
+		// once, not once per permit.
+		{"/req5",
+			`[{"community_area":"68","unemployment":28,"below_poverty_level":46.6},` +
+				`{"community_area":"25","unemployment":22,"below_poverty_level":28.6},` +
+				`{"community_area":"8","unemployment":6.5,"below_poverty_level":11.3}]`},
+		// Too short a history for a seasonal model: the naive forecast
+		// repeats the last day, with intervals from the day-to-day changes.
+		{"/req4?period=day&zip=60611&horizon=2",
+			`[{"zip_code":"60611","direction":"pickup","period":"day","model":"naive",` +
+				`"history":[{"period_start":"2023-01-02","number_of_trips":0},{"period_start":"2023-01-03","number_of_trips":0},{"period_start":"2023-01-04","number_of_trips":1}],` +
+				`"forecast":[{"period_start":"2023-01-05","number_of_trips":1,"lower_95":0,"upper_95":2.385929291125633},` +
+				`{"period_start":"2023-01-06","number_of_trips":1,"lower_95":0,"upper_95":2.9600000000000004}]},` +
+				`{"zip_code":"60611","direction":"dropoff","period":"day","model":"naive",` +
+				`"history":[{"period_start":"2023-01-02","number_of_trips":1},{"period_start":"2023-01-03","number_of_trips":1},{"period_start":"2023-01-04","number_of_trips":0}],` +
+				`"forecast":[{"period_start":"2023-01-05","number_of_trips":0,"lower_95":0,"upper_95":1.3859292911256331},` +
+				`{"period_start":"2023-01-06","number_of_trips":0,"lower_95":0,"upper_95":1.9600000000000004}]}]`},
+		{"/req6",
+			`[{"community_area":"25","permit_count":1,"per_capita_income":15957},` +
+				`{"community_area":"68","permit_count":2,"per_capita_income":11888}]`},
+	}
+	for _, report := range reports {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", report.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d: %s", report.path, rec.Code, rec.Body)
+			continue
+		}
+		if got := strings.TrimSpace(rec.Body.String()); got != report.want {
+			t.Errorf("GET %s:\ngot  %s\nwant %s", report.path, got, report.want)
+		}
+	}
+
+	// A report is as of the least recently loaded table it reads.
+	if _, err := db.Exec(`UPDATE report_refreshes SET "refreshed_at" = '2023-03-01 12:00:00' WHERE "summary" = 'unemployment'`); err != nil {
+		t.Fatal(err)
+	}
+	for path, stale := range map[string]bool{"/req2": false, "/req5": true, "/req6": true} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		got := rec.Header().Get("Last-Modified")
+		if want := "Wed, 01 Mar 2023 12:00:00 GMT"; (got == want) != stale || got == "" {
+			t.Errorf("GET %s: got Last-Modified %q, want it stale: %v", path, got, stale)
+		}
+	}
+
+	// `report` prints what the API serves.
+	var out bytes.Buffer
+	if err := runReportCommand(db, []string{"req5", "--format", "csv", "sort=community_area"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "community_area,unemployment,below_poverty_level\n25,22,28.6\n68,28,46.6\n8,6.5,11.3\n"
+	if got := out.String(); got != want {
+		t.Errorf("report req5 --format csv:\ngot  %q\nwant %q", got, want)
+	}
+	if err := runReportCommand(db, []string{"req7"}, &out); err == nil {
+		t.Error("report req7: expected an error")
+	}
+
+	// Once the quota is back, the backfill resolves the coordinates that
+	// were refused. taxi-6 keeps its pickup's final no_result.
+	atomic.StoreInt32(&quotaRestored, 1)
+	stats, err := runs[ingest.GeocodeBackfillJob]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ingest.RunStats{Fetched: 2, Inserted: 1, Skipped: map[string]int{"unresolved_no_result": 1}}); !reflect.DeepEqual(stats, want) {
+		t.Errorf("%s after the quota is restored: got stats %+v, want %+v", ingest.GeocodeBackfillJob, stats, want)
+	}
+	got := queryCounts(t, db, `SELECT "trip_id" || ' ' || COALESCE("pickup_zip_code", '-') || ' ' || COALESCE("dropoff_zip_code", '-') || ' ' || "resolution_status", 1
+		FROM transportation WHERE "trip_id" IN ('taxi-5', 'taxi-6')`)
+	if want := map[string]int{"taxi-5 60653 60601 resolved": 1, "taxi-6 - 60653 no_result": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("retried trips: got %v, want %v", got, want)
+	}
+}
+
+// queryCounts runs a query selecting (key, count) rows.
+func queryCounts(t *testing.T, db *sql.DB, query string) map[string]int {
+	t.Helper()
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			t.Fatal(err)
+		}
+		counts[key] = n
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return counts
+}
@@ -0,0 +1,178 @@
+// Command cbi collects the Chicago Business Intelligence datasets on a
+// schedule and serves the reports built from them. Its subcommands run a
+// single load or print a report from a shell or cron job instead, without
+// starting the server.
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/kelvins/geocoder"
+	"github.com/suebyeon/msds432_cbi/api"
+	"github.com/suebyeon/msds432_cbi/config"
+	"github.com/suebyeon/msds432_cbi/geo"
+	"github.com/suebyeon/msds432_cbi/ingest"
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// usage lists the subcommands. Without one, cbi serves.
+const usage = `usage: cbi [command] [arguments]
+
+commands:
+  serve                                run the collectors on their schedules and serve the reports (default)
+  ingest <job>|all [--since DATE]      run one collector, or all of them, once
+  report <name> [--format FORMAT] [param=value ...]
+                                       print a report to stdout
+  geocode backfill                     retry the zip code lookups that failed
+  migrate up|down [steps]|status       manage the database schema
+`
+
+func main() {
+
+	command, args := "serve", []string(nil)
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+
+	switch command {
+	case "serve", "ingest", "report", "geocode", "migrate":
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "cbi: unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch command {
+	case "serve", "ingest", "geocode":
+		if err := cfg.RequireGeocoder(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	db, err := store.Open(cfg.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	geocoder.ApiKey = cfg.Geocoder.APIKey
+
+	switch command {
+	case "serve":
+		err = serve(cfg, db)
+	case "ingest":
+		err = runIngestCommand(cfg, db, args)
+	case "report":
+		err = runReportCommand(db, args, os.Stdout)
+	case "geocode":
+		err = runGeocodeCommand(cfg, db, args)
+	case "migrate":
+		err = runMigrateCommand(db, args)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+}
+
+// serve runs the collectors on their schedules and serves the reports
+// until the server fails.
+func serve(cfg config.Config, db *sql.DB) error {
+	log.Print("starting CBI Microservices ...")
+
+	collector, geocodeCache, err := newCollector(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	if err := applyMigrations(db); err != nil {
+		return err
+	}
+
+	var jobs []ingest.Job
+	for name, run := range collector.Runs() {
+		schedule, err := ingest.ParseSchedule(cfg.Schedules[name])
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, ingest.Job{Name: name, Schedule: schedule, Run: ingest.RefreshAfter(db, run, ingest.SummariesFedBy[name])})
+	}
+
+	retry, err := cfg.Retry.Policy()
+	if err != nil {
+		return err
+	}
+
+	scheduler := ingest.NewScheduler(db, retry, jobs...)
+	scheduler.Start()
+
+	mux := api.NewServeMux(db, store.NewSQLStore(db), geocodeCache)
+
+	// Determine port for HTTP service.
+	port := cfg.HTTPPort
+
+	// Start HTTP server.
+	log.Printf("listening on port %s", port)
+	log.Print("Navigate to Cloud Run services and find the URL of your service")
+	log.Print("Use the browser and navigate to your service URL to to check your service has started")
+
+	return http.ListenAndServe(":"+port, mux)
+}
+
+// applyMigrations brings the schema up to date before jobs write to it.
+func applyMigrations(db *sql.DB) error {
+	applied, err := store.MigrateUp(db)
+	for _, mig := range applied {
+		log.Printf("applied migration %04d_%s", mig.Version, mig.Name)
+	}
+	return err
+}
+
+// newCollector wires the collectors to their data source and zip code
+// resolver as configured. The geocode cache is nil when zip codes are
+// resolved offline.
+func newCollector(cfg config.Config, db *sql.DB) (*ingest.Collector, *geo.CachingResolver, error) {
+	// A fixture directory replays recorded SODA responses instead of
+	// calling the Chicago Data Portal.
+	var src ingest.Source = ingest.NewSODASource(cfg.SODA.Datasets)
+	if dir := cfg.SODA.FixtureDir; dir != "" {
+		log.Printf("reading SODA datasets from %s", dir)
+		src = &ingest.FileSource{Dir: dir}
+	}
+
+	// A zip boundaries file resolves zip codes offline from boundary
+	// polygons instead of calling the Google reverse geocoding API. Google
+	// lookups go through the geocode cache and are rate limited.
+	var zips geo.ZipResolver
+	var geocodeCache *geo.CachingResolver
+	if path := cfg.Geocoder.ZipBoundariesFile; path != "" {
+		resolver, err := geo.LoadZipBoundaries(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("resolving zip codes from %s", path)
+		zips = resolver
+	} else {
+		google := geo.NewRateLimitedResolver(geo.GoogleResolver{}, cfg.Geocoder.RequestsPerSecond)
+		geocodeCache = geo.NewCachingResolver(google, db, cfg.Geocoder.CachePrecision, cfg.Geocoder.CacheSize)
+		zips = geocodeCache
+	}
+
+	return &ingest.Collector{
+		DB:        db,
+		Source:    src,
+		Zips:      zips,
+		SODA:      cfg.SODA,
+		BatchSize: cfg.DB.BatchSize,
+		Workers:   cfg.Geocoder.Workers,
+	}, geocodeCache, nil
+}
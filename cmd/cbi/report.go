@@ -0,0 +1,45 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/suebyeon/msds432_cbi/api"
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// runReportCommand implements `report <name> [--format json|csv|geojson|parquet] [param=value ...]`.
+// The params are the query parameters GET /<name> takes, and the report is
+// rendered as the API renders it and written to out.
+func runReportCommand(db *sql.DB, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: report %s [--format json|csv|geojson|parquet] [param=value ...]", strings.Join(api.ReportNames, "|"))
+	}
+	name := args[0]
+
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := flags.String("format", "json", "output format: json, csv, geojson or parquet")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	for _, param := range flags.Args() {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("report: invalid parameter %q, want name=value", param)
+		}
+		query.Add(kv[0], kv[1])
+	}
+
+	report, err := api.RenderReport(store.NewSQLStore(db), name, query, *format)
+	if err != nil {
+		return fmt.Errorf("report %s: %v", name, err)
+	}
+	_, err = out.Write(report.Body)
+	return err
+}
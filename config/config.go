@@ -0,0 +1,332 @@
+// Package config loads the service configuration from defaults, a JSON
+// file and environment variables.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suebyeon/msds432_cbi/ingest"
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// Config is the service configuration. It is built from defaults, then the
+// JSON file named by CBI_CONFIG (if any), then environment variables.
+type Config struct {
+	DB       store.Config      `json:"db"`
+	Geocoder GeocoderConfig    `json:"geocoder"`
+	SODA     ingest.SODAConfig `json:"soda"`
+	HTTPPort string            `json:"http_port"`
+
+	// Schedules maps each collector job to an interval ("1h"), a
+	// descriptor ("@daily") or a cron expression ("0 3 * * *").
+	Schedules map[string]string `json:"schedules"`
+
+	Retry RetryConfig `json:"retry"`
+}
+
+type GeocoderConfig struct {
+	// APIKey is the Google geocoding API key. It is only required when
+	// ZipBoundariesFile is empty.
+	APIKey string `json:"api_key"`
+
+	// ZipBoundariesFile resolves zip codes offline from boundary polygons.
+	ZipBoundariesFile string `json:"zip_boundaries_file"`
+
+	// CachePrecision is how many decimal places coordinates are rounded
+	// to before the geocode cache lookup. CacheSize bounds the in-process
+	// LRU in front of the geocode_cache table.
+	CachePrecision int `json:"cache_precision"`
+	CacheSize      int `json:"cache_size"`
+
+	// Workers is how many lookups run concurrently. RequestsPerSecond caps
+	// calls to the Google API across all workers; 0 means no limit.
+	Workers           int `json:"workers"`
+	RequestsPerSecond int `json:"requests_per_second"`
+}
+
+// RetryConfig controls how a failed collector run is retried before the
+// job waits for its next scheduled run.
+type RetryConfig struct {
+	// MaxAttempts includes the first run; 1 disables retries.
+	MaxAttempts int `json:"max_attempts"`
+
+	// Backoff is the wait before the first retry, as a Go duration. It
+	// doubles after each failed attempt up to MaxBackoff.
+	Backoff    string `json:"backoff"`
+	MaxBackoff string `json:"max_backoff"`
+}
+
+// Default returns the configuration used where nothing overrides it.
+func Default() Config {
+	return Config{
+		DB: store.Config{
+			Driver:    store.PostgresDriver,
+			Port:      5432,
+			SSLMode:   "disable",
+			BatchSize: 1000,
+		},
+		SODA: ingest.SODAConfig{
+			MaxRows: 50000,
+			Datasets: map[string]ingest.DatasetConfig{
+				ingest.BoundariesDataset:      {URL: "https://data.cityofchicago.org/resource/unjd-c2ca.json", PageSize: 1000},
+				ingest.TaxiTripsDataset:       {URL: "https://data.cityofchicago.org/resource/wrvz-psew.json", PageSize: 500},
+				ingest.TNPTripsDataset:        {URL: "https://data.cityofchicago.org/resource/m6dm-c72p.json", PageSize: 500},
+				ingest.UnemploymentDataset:    {URL: "https://data.cityofchicago.org/resource/iqnk-2tcu.json", PageSize: 100},
+				ingest.BuildingPermitsDataset: {URL: "https://data.cityofchicago.org/resource/building-permits.json", PageSize: 500},
+				ingest.CovidDataset:           {URL: "https://data.cityofchicago.org/resource/yhhz-zm2v.json", PageSize: 500},
+				ingest.CCVIDataset:            {URL: "https://data.cityofchicago.org/resource/xhc6-88s9.json", PageSize: 500},
+				ingest.CommunityAreasDataset:  {URL: "https://data.cityofchicago.org/resource/igwz-8jzy.json", PageSize: 100},
+			},
+		},
+		Geocoder: GeocoderConfig{
+			CachePrecision:    4,
+			CacheSize:         10000,
+			Workers:           8,
+			RequestsPerSecond: 10,
+		},
+		HTTPPort: "8080",
+		Schedules: map[string]string{
+			ingest.BoundariesJob:     "@monthly",
+			ingest.TripsJob:          "@hourly",
+			ingest.UnemploymentJob:   "@monthly",
+			ingest.PermitsJob:        "@daily",
+			ingest.CovidJob:          "@weekly",
+			ingest.CCVIJob:           "@monthly",
+			ingest.CommunityAreasJob: "@monthly",
+
+			ingest.GeocodeBackfillJob: "@daily",
+		},
+		Retry: RetryConfig{
+			MaxAttempts: 4,
+			Backoff:     "30s",
+			MaxBackoff:  "10m",
+		},
+	}
+}
+
+// Load builds the configuration and validates it.
+func Load() (Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv("CBI_CONFIG"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+
+	// Decode dataset overrides separately so a file that only sets a page
+	// size keeps the default URL, and vice versa.
+	defaults := c.SODA.Datasets
+	c.SODA.Datasets = nil
+	if err := json.Unmarshal(body, c); err != nil {
+		return fmt.Errorf("config %s: %v", path, err)
+	}
+
+	for job := range c.Schedules {
+		if _, ok := Default().Schedules[job]; !ok {
+			return fmt.Errorf("config %s: unknown schedule %q", path, job)
+		}
+	}
+
+	overrides := c.SODA.Datasets
+	c.SODA.Datasets = defaults
+	for name, override := range overrides {
+		ds, ok := c.SODA.Datasets[name]
+		if !ok {
+			return fmt.Errorf("config %s: unknown dataset %q", path, name)
+		}
+		if override.URL != "" {
+			ds.URL = override.URL
+		}
+		if override.PageSize != 0 {
+			ds.PageSize = override.PageSize
+		}
+		c.SODA.Datasets[name] = ds
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	envString("DB_DRIVER", &c.DB.Driver)
+	envString("DB_PATH", &c.DB.Path)
+	envString("DB_HOST", &c.DB.Host)
+	envString("DB_USER", &c.DB.User)
+	envString("DB_PASSWORD", &c.DB.Password)
+	envString("DB_NAME", &c.DB.Name)
+	envString("DB_SSLMODE", &c.DB.SSLMode)
+	envString("GEOCODER_API_KEY", &c.Geocoder.APIKey)
+	envString("ZIP_BOUNDARIES_FILE", &c.Geocoder.ZipBoundariesFile)
+	envString("SODA_FIXTURE_DIR", &c.SODA.FixtureDir)
+	envString("PORT", &c.HTTPPort)
+	envString("RETRY_BACKOFF", &c.Retry.Backoff)
+	envString("RETRY_MAX_BACKOFF", &c.Retry.MaxBackoff)
+
+	if err := envInt("DB_PORT", &c.DB.Port); err != nil {
+		return err
+	}
+	if err := envInt("DB_BATCH_SIZE", &c.DB.BatchSize); err != nil {
+		return err
+	}
+	if err := envInt("GEOCODER_CACHE_PRECISION", &c.Geocoder.CachePrecision); err != nil {
+		return err
+	}
+	if err := envInt("GEOCODER_CACHE_SIZE", &c.Geocoder.CacheSize); err != nil {
+		return err
+	}
+	if err := envInt("GEOCODER_WORKERS", &c.Geocoder.Workers); err != nil {
+		return err
+	}
+	if err := envInt("GEOCODER_REQUESTS_PER_SECOND", &c.Geocoder.RequestsPerSecond); err != nil {
+		return err
+	}
+	if err := envInt("SODA_MAX_ROWS", &c.SODA.MaxRows); err != nil {
+		return err
+	}
+	if err := envInt("RETRY_MAX_ATTEMPTS", &c.Retry.MaxAttempts); err != nil {
+		return err
+	}
+
+	// Per-dataset overrides, e.g. SODA_TAXI_TRIPS_URL and
+	// SODA_TAXI_TRIPS_PAGE_SIZE.
+	for name, ds := range c.SODA.Datasets {
+		prefix := "SODA_" + strings.ToUpper(name)
+		envString(prefix+"_URL", &ds.URL)
+		if err := envInt(prefix+"_PAGE_SIZE", &ds.PageSize); err != nil {
+			return err
+		}
+		c.SODA.Datasets[name] = ds
+	}
+
+	// Per-job schedules, e.g. SCHEDULE_TRIPS=30m.
+	for job, spec := range c.Schedules {
+		envString("SCHEDULE_"+strings.ToUpper(job), &spec)
+		c.Schedules[job] = spec
+	}
+	return nil
+}
+
+func envString(key string, dst *string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = v
+	}
+}
+
+func envInt(key string, dst *int) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("config: %s must be an integer, got %q", key, v)
+	}
+	*dst = n
+	return nil
+}
+
+// RequireGeocoder checks that zip codes can be resolved, with a geocoding
+// API key or a zip boundaries file. Only the commands that resolve them
+// need either.
+func (c Config) RequireGeocoder() error {
+	if c.Geocoder.APIKey == "" && c.Geocoder.ZipBoundariesFile == "" {
+		return errors.New("config: missing required settings: GEOCODER_API_KEY (geocoder.api_key) or ZIP_BOUNDARIES_FILE (geocoder.zip_boundaries_file)")
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	var missing []string
+	switch c.DB.Driver {
+	case store.PostgresDriver:
+		if c.DB.Host == "" {
+			missing = append(missing, "DB_HOST (db.host)")
+		}
+		if c.DB.User == "" {
+			missing = append(missing, "DB_USER (db.user)")
+		}
+		if c.DB.Name == "" {
+			missing = append(missing, "DB_NAME (db.name)")
+		}
+	case store.SQLiteDriver:
+		if c.DB.Path == "" {
+			missing = append(missing, "DB_PATH (db.path)")
+		}
+	default:
+		return fmt.Errorf("config: db.driver must be postgres or sqlite, got %q", c.DB.Driver)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("config: missing required settings: %s", strings.Join(missing, ", "))
+	}
+
+	if c.DB.BatchSize < 1 {
+		return errors.New("config: db.batch_size must be at least 1")
+	}
+	if c.Geocoder.CachePrecision < 0 || c.Geocoder.CachePrecision > 8 {
+		return errors.New("config: geocoder.cache_precision must be between 0 and 8")
+	}
+	if c.Geocoder.CacheSize < 0 {
+		return errors.New("config: geocoder.cache_size must not be negative")
+	}
+	if c.Geocoder.Workers < 1 {
+		return errors.New("config: geocoder.workers must be at least 1")
+	}
+	if c.Geocoder.RequestsPerSecond < 0 {
+		return errors.New("config: geocoder.requests_per_second must not be negative")
+	}
+	if c.SODA.MaxRows < 0 {
+		return errors.New("config: soda.max_rows must not be negative")
+	}
+	for name, ds := range c.SODA.Datasets {
+		if ds.URL == "" {
+			return fmt.Errorf("config: dataset %s has no url", name)
+		}
+		if ds.PageSize <= 0 {
+			return fmt.Errorf("config: dataset %s page_size must be positive", name)
+		}
+	}
+	for job, spec := range c.Schedules {
+		if _, err := ingest.ParseSchedule(spec); err != nil {
+			return fmt.Errorf("config: job %s: %v", job, err)
+		}
+	}
+	if _, err := c.Retry.Policy(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Policy converts the retry settings for the scheduler.
+func (c RetryConfig) Policy() (ingest.RetryPolicy, error) {
+	if c.MaxAttempts < 1 {
+		return ingest.RetryPolicy{}, errors.New("config: retry.max_attempts must be at least 1")
+	}
+	backoff, err := time.ParseDuration(c.Backoff)
+	if err != nil {
+		return ingest.RetryPolicy{}, fmt.Errorf("config: retry.backoff: %v", err)
+	}
+	maxBackoff, err := time.ParseDuration(c.MaxBackoff)
+	if err != nil {
+		return ingest.RetryPolicy{}, fmt.Errorf("config: retry.max_backoff: %v", err)
+	}
+	return ingest.RetryPolicy{MaxAttempts: c.MaxAttempts, Backoff: backoff, MaxBackoff: maxBackoff}, nil
+}
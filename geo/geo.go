@@ -0,0 +1,422 @@
+// Package geo resolves coordinates to Chicago zip codes, with the Google
+// reverse geocoding API or offline from zip code boundary polygons, and
+// caches and parallelizes the lookups.
+package geo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kelvins/geocoder"
+)
+
+// Errors a ZipResolver returns when a coordinate has no zip code.
+var (
+	ErrNoAddress    = errors.New("no address found for coordinate")
+	ErrNoPostalCode = errors.New("address has no postal code")
+)
+
+// Values of the resolution_status column on rows that carry zip codes. Any
+// status other than ResolvedStatus leaves the zip code null so the row can
+// be re-resolved later.
+const (
+	ResolvedStatus     = "resolved"
+	NoResultStatus     = "no_result"
+	NoPostalCodeStatus = "no_postal_code"
+	FailedStatus       = "failed"
+)
+
+// resolutionStatus classifies the error returned by a ZipResolver.
+func resolutionStatus(err error) string {
+	switch err {
+	case nil:
+		return ResolvedStatus
+	case ErrNoAddress:
+		return NoResultStatus
+	case ErrNoPostalCode:
+		return NoPostalCodeStatus
+	}
+	return FailedStatus
+}
+
+// statusError is the error a ZipResolver returned for a final status, the
+// reverse of resolutionStatus.
+func statusError(status string) error {
+	switch status {
+	case NoResultStatus:
+		return ErrNoAddress
+	case NoPostalCodeStatus:
+		return ErrNoPostalCode
+	}
+	return nil
+}
+
+// ZipResolver maps a coordinate to the zip code that contains it. It
+// returns ErrNoAddress when nothing is found at the coordinate and
+// ErrNoPostalCode when what is found has no zip code.
+type ZipResolver interface {
+	ZipCode(latitude, longitude float64) (string, error)
+}
+
+// googleZeroResults is the message of the error the geocoder package
+// returns for a ZERO_RESULTS response.
+const googleZeroResults = "No results found."
+
+// GoogleResolver resolves zip codes with the Google reverse geocoding API.
+// geocoder.ApiKey must be set before use.
+type GoogleResolver struct{}
+
+func (GoogleResolver) ZipCode(latitude, longitude float64) (string, error) {
+	location := geocoder.Location{
+		Latitude:  latitude,
+		Longitude: longitude,
+	}
+
+	// The geocoder package reports ZERO_RESULTS as an error of its own,
+	// told apart from quota and transport errors only by its message.
+	address_list, err := geocoder.GeocodingReverse(location)
+	if err != nil && err.Error() == googleZeroResults {
+		return "", ErrNoAddress
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(address_list) == 0 {
+		return "", ErrNoAddress
+	}
+
+	if address_list[0].PostalCode == "" {
+		return "", ErrNoPostalCode
+	}
+	return address_list[0].PostalCode, nil
+}
+
+// point is a longitude/latitude pair, in GeoJSON order.
+type point [2]float64
+
+// ring is a closed linear ring of points.
+type ring []point
+
+// polygon is an outer ring followed by zero or more holes.
+type polygon []ring
+
+type zipArea struct {
+	zip      string
+	polygons []polygon
+	min, max point
+}
+
+// PolygonResolver resolves zip codes in memory from Chicago zip code
+// boundary polygons.
+type PolygonResolver struct {
+	areas []zipArea
+}
+
+func (r *PolygonResolver) ZipCode(latitude, longitude float64) (string, error) {
+	p := point{longitude, latitude}
+	for _, area := range r.areas {
+		if p[0] < area.min[0] || p[0] > area.max[0] || p[1] < area.min[1] || p[1] > area.max[1] {
+			continue
+		}
+		for _, poly := range area.polygons {
+			if poly.contains(p) {
+				return area.zip, nil
+			}
+		}
+	}
+	return "", ErrNoAddress
+}
+
+// LoadZipBoundaries reads zip code boundaries from path. Supported formats
+// are a GeoJSON FeatureCollection, a SODA JSON export of the boundaries
+// dataset (rows with "zip" and "the_geom"), and a CSV export with a WKT
+// "the_geom" column.
+func LoadZipBoundaries(path string) (*PolygonResolver, error) {
+	var areas []zipArea
+	var err error
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		areas, err = loadZipBoundariesCSV(path)
+	} else {
+		areas, err = loadZipBoundariesJSON(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("zip boundaries %s: %v", path, err)
+	}
+	if len(areas) == 0 {
+		return nil, fmt.Errorf("zip boundaries %s: no polygons found", path)
+	}
+
+	return &PolygonResolver{areas: areas}, nil
+}
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func loadZipBoundariesJSON(path string) ([]zipArea, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SODA export: [{"zip": "60601", "the_geom": {...}}, ...]
+	var rows []struct {
+		Zip  string          `json:"zip"`
+		Geom geoJSONGeometry `json:"the_geom"`
+	}
+	if err := json.Unmarshal(body, &rows); err == nil {
+		var areas []zipArea
+		for _, row := range rows {
+			polygons, err := row.Geom.polygons()
+			if err != nil {
+				return nil, fmt.Errorf("zip %s: %v", row.Zip, err)
+			}
+			areas = append(areas, newZipArea(row.Zip, polygons))
+		}
+		return areas, nil
+	}
+
+	var collection struct {
+		Features []struct {
+			Properties map[string]interface{} `json:"properties"`
+			Geometry   geoJSONGeometry        `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(body, &collection); err != nil {
+		return nil, err
+	}
+
+	var areas []zipArea
+	for _, feature := range collection.Features {
+		zip := zipProperty(feature.Properties)
+		if zip == "" {
+			continue
+		}
+		polygons, err := feature.Geometry.polygons()
+		if err != nil {
+			return nil, fmt.Errorf("zip %s: %v", zip, err)
+		}
+		areas = append(areas, newZipArea(zip, polygons))
+	}
+	return areas, nil
+}
+
+func zipProperty(properties map[string]interface{}) string {
+	for key, value := range properties {
+		switch strings.ToLower(key) {
+		case "zip", "zip_code", "zipcode", "zcta5ce10":
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+func (g geoJSONGeometry) polygons() ([]polygon, error) {
+	switch g.Type {
+	case "Polygon":
+		var poly polygon
+		if err := json.Unmarshal(g.Coordinates, &poly); err != nil {
+			return nil, err
+		}
+		return []polygon{poly}, nil
+	case "MultiPolygon":
+		var polygons []polygon
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, err
+		}
+		return polygons, nil
+	}
+	return nil, fmt.Errorf("unsupported geometry type %q", g.Type)
+}
+
+func loadZipBoundariesCSV(path string) ([]zipArea, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	geomCol, zipCol := -1, -1
+	for i, name := range records[0] {
+		switch strings.ToLower(name) {
+		case "the_geom":
+			geomCol = i
+		case "zip":
+			zipCol = i
+		}
+	}
+	if geomCol < 0 || zipCol < 0 {
+		return nil, errors.New("csv needs the_geom and zip columns")
+	}
+
+	var areas []zipArea
+	for _, record := range records[1:] {
+		polygons, err := parseWKT(record[geomCol])
+		if err != nil {
+			return nil, fmt.Errorf("zip %s: %v", record[zipCol], err)
+		}
+		areas = append(areas, newZipArea(record[zipCol], polygons))
+	}
+	return areas, nil
+}
+
+// parseWKT parses a WKT POLYGON or MULTIPOLYGON.
+func parseWKT(wkt string) ([]polygon, error) {
+	wkt = strings.TrimSpace(wkt)
+	open := strings.Index(wkt, "(")
+	if open < 0 {
+		return nil, errors.New("wkt: missing coordinates")
+	}
+	kind := strings.ToUpper(strings.TrimSpace(wkt[:open]))
+
+	tree, _, err := parseWKTList(wkt, open)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "POLYGON":
+		poly, err := tree.polygon()
+		if err != nil {
+			return nil, err
+		}
+		return []polygon{poly}, nil
+	case "MULTIPOLYGON":
+		var polygons []polygon
+		for _, child := range tree.children {
+			poly, err := child.polygon()
+			if err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, poly)
+		}
+		return polygons, nil
+	}
+	return nil, fmt.Errorf("wkt: unsupported geometry type %q", kind)
+}
+
+// wktNode is a parenthesised WKT list. Innermost lists hold the coordinate
+// text, e.g. "-87.6 41.8, -87.7 41.9".
+type wktNode struct {
+	children []wktNode
+	text     string
+}
+
+func parseWKTList(s string, i int) (wktNode, int, error) {
+	var node wktNode
+	start := i + 1
+	for i = start; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			child, end, err := parseWKTList(s, i)
+			if err != nil {
+				return node, 0, err
+			}
+			node.children = append(node.children, child)
+			i = end
+		case ')':
+			if len(node.children) == 0 {
+				node.text = s[start:i]
+			}
+			return node, i, nil
+		}
+	}
+	return node, 0, errors.New("wkt: unbalanced parentheses")
+}
+
+func (n wktNode) polygon() (polygon, error) {
+	var poly polygon
+	for _, child := range n.children {
+		var r ring
+		for _, pair := range strings.Split(child.text, ",") {
+			fields := strings.Fields(pair)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("wkt: bad coordinate %q", pair)
+			}
+			x, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return nil, err
+			}
+			y, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, point{x, y})
+		}
+		poly = append(poly, r)
+	}
+	return poly, nil
+}
+
+func newZipArea(zip string, polygons []polygon) zipArea {
+	area := zipArea{zip: zip, polygons: polygons}
+	first := true
+	for _, poly := range polygons {
+		if len(poly) == 0 {
+			continue
+		}
+		for _, p := range poly[0] {
+			if first {
+				area.min, area.max = p, p
+				first = false
+				continue
+			}
+			if p[0] < area.min[0] {
+				area.min[0] = p[0]
+			}
+			if p[1] < area.min[1] {
+				area.min[1] = p[1]
+			}
+			if p[0] > area.max[0] {
+				area.max[0] = p[0]
+			}
+			if p[1] > area.max[1] {
+				area.max[1] = p[1]
+			}
+		}
+	}
+	return area
+}
+
+// contains reports whether p is inside the outer ring and outside every hole.
+func (poly polygon) contains(p point) bool {
+	if len(poly) == 0 || !poly[0].contains(p) {
+		return false
+	}
+	for _, hole := range poly[1:] {
+		if hole.contains(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains uses the even-odd ray casting rule.
+func (r ring) contains(p point) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a[1] > p[1]) != (b[1] > p[1]) &&
+			p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
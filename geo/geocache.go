@@ -0,0 +1,169 @@
+package geo
+
+import (
+	"container/list"
+	"database/sql"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// CachingResolver puts an in-process LRU and the geocode_cache table in
+// front of another ZipResolver. Coordinates are rounded to a fixed number
+// of decimal places before lookup, so only coordinates that have never
+// been seen reach the wrapped resolver. Final negative answers, no_result
+// and no_postal_code, are cached with a null zip code and their status;
+// failed lookups are not cached, so they are retried.
+type CachingResolver struct {
+	// Accessed atomically; kept first for 64-bit alignment.
+	lruHits int64
+	dbHits  int64
+	misses  int64
+
+	next      ZipResolver
+	db        *sql.DB
+	precision int
+
+	mu  sync.Mutex
+	lru *lruCache
+}
+
+// CacheStats reports how a CachingResolver's lookups were served.
+type CacheStats struct {
+	LRUHits int64 `json:"lru_hits"`
+	DBHits  int64 `json:"db_hits"`
+	Misses  int64 `json:"misses"`
+	LRUSize int   `json:"lru_size"`
+}
+
+func NewCachingResolver(next ZipResolver, db *sql.DB, precision, size int) *CachingResolver {
+	return &CachingResolver{
+		next:      next,
+		db:        db,
+		precision: precision,
+		lru:       newLRUCache(size),
+	}
+}
+
+type coordKey struct {
+	lat, lon string
+}
+
+func (r *CachingResolver) key(latitude, longitude float64) coordKey {
+	scale := math.Pow(10, float64(r.precision))
+	round := func(v float64) string {
+		return strconv.FormatFloat(math.Round(v*scale)/scale, 'f', r.precision, 64)
+	}
+	return coordKey{lat: round(latitude), lon: round(longitude)}
+}
+
+func (r *CachingResolver) ZipCode(latitude, longitude float64) (string, error) {
+	key := r.key(latitude, longitude)
+
+	r.mu.Lock()
+	entry, ok := r.lru.get(key)
+	r.mu.Unlock()
+	if ok {
+		atomic.AddInt64(&r.lruHits, 1)
+		return entry.zip, statusError(entry.status)
+	}
+
+	var zip sql.NullString
+	var status string
+	err := r.db.QueryRow(`SELECT "zip_code", "resolution_status" FROM geocode_cache WHERE "lat_key" = $1 AND "lon_key" = $2`,
+		key.lat, key.lon).Scan(&zip, &status)
+	switch {
+	case err == nil:
+		atomic.AddInt64(&r.dbHits, 1)
+		r.remember(key, zip.String, status)
+		return zip.String, statusError(status)
+	case err != sql.ErrNoRows:
+		return "", err
+	}
+
+	atomic.AddInt64(&r.misses, 1)
+	code, err := r.next.ZipCode(latitude, longitude)
+	status = resolutionStatus(err)
+	if status == FailedStatus || err == nil && code == "" {
+		return code, err
+	}
+	zip = sql.NullString{String: code, Valid: err == nil}
+
+	_, dbErr := r.db.Exec(`INSERT INTO geocode_cache ("lat_key", "lon_key", "zip_code", "resolution_status") values($1, $2, $3, $4)
+		ON CONFLICT ("lat_key", "lon_key") DO UPDATE SET "zip_code" = EXCLUDED."zip_code",
+			"resolution_status" = EXCLUDED."resolution_status", "resolved_at" = CURRENT_TIMESTAMP`,
+		key.lat, key.lon, zip, status)
+	if dbErr != nil {
+		return "", dbErr
+	}
+	r.remember(key, code, status)
+	return code, err
+}
+
+func (r *CachingResolver) remember(key coordKey, zip, status string) {
+	r.mu.Lock()
+	r.lru.add(lruEntry{key: key, zip: zip, status: status})
+	r.mu.Unlock()
+}
+
+func (r *CachingResolver) Stats() CacheStats {
+	r.mu.Lock()
+	size := r.lru.len()
+	r.mu.Unlock()
+
+	return CacheStats{
+		LRUHits: atomic.LoadInt64(&r.lruHits),
+		DBHits:  atomic.LoadInt64(&r.dbHits),
+		Misses:  atomic.LoadInt64(&r.misses),
+		LRUSize: size,
+	}
+}
+
+// lruCache is a fixed-size least-recently-used map. It is not safe for
+// concurrent use.
+type lruCache struct {
+	size  int
+	order *list.List
+	items map[coordKey]*list.Element
+}
+
+type lruEntry struct {
+	key    coordKey
+	zip    string
+	status string
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{size: size, order: list.New(), items: map[coordKey]*list.Element{}}
+}
+
+func (c *lruCache) get(key coordKey) (lruEntry, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return lruEntry{}, false
+	}
+	c.order.MoveToFront(el)
+	return *el.Value.(*lruEntry), true
+}
+
+func (c *lruCache) add(entry lruEntry) {
+	if c.size <= 0 {
+		return
+	}
+	if el, ok := c.items[entry.key]; ok {
+		*el.Value.(*lruEntry) = entry
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[entry.key] = c.order.PushFront(&entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) len() int {
+	return c.order.Len()
+}
@@ -0,0 +1,76 @@
+package geo
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// countingResolver counts the lookups that reach the resolver it wraps.
+type countingResolver struct {
+	next  ZipResolver
+	calls map[LatLon]int
+}
+
+func (c *countingResolver) ZipCode(latitude, longitude float64) (string, error) {
+	c.calls[LatLon{latitude, longitude}]++
+	return c.next.ZipCode(latitude, longitude)
+}
+
+// Final answers are cached, in the LRU and in geocode_cache, so asking
+// again makes no upstream call; failures are asked again.
+func TestCachingResolverNegative(t *testing.T) {
+	db, err := store.Open(store.Config{Driver: store.SQLiteDriver, Path: filepath.Join(t.TempDir(), "cbi.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := store.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, noResult, noPostalCode, failed := LatLon{41.9, -87.6}, LatLon{42.0, -87.5}, LatLon{41.8, -87.6}, LatLon{41.7, -87.7}
+	overQuota := errors.New("OVER_QUERY_LIMIT")
+	upstream := &countingResolver{
+		next: fakeResolver{
+			noResult:     ErrNoAddress,
+			noPostalCode: ErrNoPostalCode,
+			failed:       overQuota,
+		},
+		calls: map[LatLon]int{},
+	}
+	tests := []struct {
+		coord LatLon
+		zip   string
+		err   error
+		calls int
+	}{
+		{resolved, "60611", nil, 1},
+		{noResult, "", ErrNoAddress, 1},
+		{noPostalCode, "", ErrNoPostalCode, 1},
+		{failed, "", overQuota, 4},
+	}
+
+	// The first resolver answers from upstream and then its LRU; the
+	// second, with an empty LRU, from geocode_cache.
+	for _, cache := range []*CachingResolver{
+		NewCachingResolver(upstream, db, 4, 10),
+		NewCachingResolver(upstream, db, 4, 10),
+	} {
+		for i := 0; i < 2; i++ {
+			for _, tt := range tests {
+				zip, err := cache.ZipCode(tt.coord.Latitude, tt.coord.Longitude)
+				if zip != tt.zip || err != tt.err {
+					t.Errorf("%v: got %q, %v, want %q, %v", tt.coord, zip, err, tt.zip, tt.err)
+				}
+			}
+		}
+	}
+	for _, tt := range tests {
+		if n := upstream.calls[tt.coord]; n != tt.calls {
+			t.Errorf("%v: got %d upstream calls, want %d", tt.coord, n, tt.calls)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package geo
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// LatLon is a coordinate to resolve.
+type LatLon struct {
+	Latitude, Longitude float64
+}
+
+// Request asks for the zip code of each coordinate of one record. Index
+// identifies the record to the caller.
+type Request struct {
+	Index  int
+	Coords []LatLon
+}
+
+// Result answers a Request. Zips and Errs line up with the request's
+// Coords; a coordinate that could not be resolved has an empty zip and the
+// resolver's error.
+type Result struct {
+	Index int
+	Zips  []string
+	Errs  []error
+}
+
+// Zip returns the i'th zip code, or NULL if it was not resolved.
+func (r Result) Zip(i int) sql.NullString {
+	return sql.NullString{String: r.Zips[i], Valid: r.Errs[i] == nil}
+}
+
+// Status returns the resolution_status for the record: ResolvedStatus if
+// every coordinate was resolved, FailedStatus if any lookup failed and
+// can be retried, and otherwise the final status of the first coordinate
+// without a zip code. A retryable failure wins, so the backfill retries it
+// even if another coordinate has no zip code for good.
+func (r Result) Status() string {
+	status := ResolvedStatus
+	for _, err := range r.Errs {
+		switch s := resolutionStatus(err); {
+		case s == FailedStatus:
+			return FailedStatus
+		case s != ResolvedStatus && status == ResolvedStatus:
+			status = s
+		}
+	}
+	return status
+}
+
+// Resolve resolves requests on a pool of workers and hands every result
+// to handle on the calling goroutine, so handle can write to the database
+// without locking. Results arrive in no particular order. If handle returns
+// an error the workers are stopped and the error is returned.
+func Resolve(zips ZipResolver, workers int, requests []Request, handle func(Result) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	queue := make(chan Request)
+	results := make(chan Result)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(queue)
+		for _, req := range requests {
+			select {
+			case queue <- req:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range queue {
+				select {
+				case results <- resolveRequest(zips, req):
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var err error
+	for res := range results {
+		if err != nil {
+			continue
+		}
+		if err = handle(res); err != nil {
+			close(done)
+		}
+	}
+	return err
+}
+
+// resolveRequest resolves every coordinate of req, carrying on past
+// failures so that one bad coordinate does not lose the others.
+func resolveRequest(zips ZipResolver, req Request) Result {
+	res := Result{
+		Index: req.Index,
+		Zips:  make([]string, len(req.Coords)),
+		Errs:  make([]error, len(req.Coords)),
+	}
+	for i, c := range req.Coords {
+		res.Zips[i], res.Errs[i] = zips.ZipCode(c.Latitude, c.Longitude)
+	}
+	return res
+}
+
+// rateLimitedResolver spaces calls to the wrapped resolver so that no more
+// than a fixed number start each second, however many workers share it.
+// Each call reserves the next free slot and sleeps until it, so there is
+// no background ticker to stop when the resolver is no longer used.
+type rateLimitedResolver struct {
+	next     ZipResolver
+	interval time.Duration
+
+	mu   sync.Mutex
+	slot time.Time
+}
+
+// NewRateLimitedResolver limits next to perSecond calls a second. A
+// perSecond of 0 or less returns next unchanged.
+func NewRateLimitedResolver(next ZipResolver, perSecond int) ZipResolver {
+	if perSecond <= 0 {
+		return next
+	}
+	return &rateLimitedResolver{
+		next:     next,
+		interval: time.Second / time.Duration(perSecond),
+	}
+}
+
+func (r *rateLimitedResolver) ZipCode(latitude, longitude float64) (string, error) {
+	time.Sleep(time.Until(r.reserve()))
+	return r.next.ZipCode(latitude, longitude)
+}
+
+// reserve returns the time the caller may start its call at: now, unless
+// the previous caller's slot ends later.
+func (r *rateLimitedResolver) reserve() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.slot.Before(now) {
+		r.slot = now
+	}
+	start := r.slot
+	r.slot = start.Add(r.interval)
+	return start
+}
@@ -0,0 +1,87 @@
+package geo
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers each coordinate with a fixed zip code or error.
+type fakeResolver map[LatLon]error
+
+func (f fakeResolver) ZipCode(latitude, longitude float64) (string, error) {
+	if err := f[LatLon{latitude, longitude}]; err != nil {
+		return "", err
+	}
+	return "60611", nil
+}
+
+func TestResolveStatus(t *testing.T) {
+	resolved, noResult, noPostalCode, failed := LatLon{41.9, -87.6}, LatLon{42.0, -87.5}, LatLon{41.8, -87.6}, LatLon{41.7, -87.7}
+	zips := fakeResolver{
+		noResult:     ErrNoAddress,
+		noPostalCode: ErrNoPostalCode,
+		failed:       errors.New("OVER_QUERY_LIMIT"),
+	}
+
+	tests := []struct {
+		coords []LatLon
+		want   string
+	}{
+		{[]LatLon{resolved, resolved}, ResolvedStatus},
+		{[]LatLon{resolved, noResult}, NoResultStatus},
+		{[]LatLon{noPostalCode, noResult}, NoPostalCodeStatus},
+
+		// A failure that can be retried outranks a final answer, whichever
+		// coordinate it is.
+		{[]LatLon{noResult, failed}, FailedStatus},
+		{[]LatLon{failed, noPostalCode}, FailedStatus},
+	}
+	var requests []Request
+	for i, tt := range tests {
+		requests = append(requests, Request{Index: i, Coords: tt.coords})
+	}
+
+	got := map[int]Result{}
+	err := Resolve(zips, 2, requests, func(res Result) error {
+		got[res.Index] = res
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		res := got[i]
+		if s := res.Status(); s != tt.want {
+			t.Errorf("%v: got status %s, want %s", tt.coords, s, tt.want)
+		}
+		for j, c := range tt.coords {
+			if zip := res.Zip(j); zip.Valid != (c == resolved) {
+				t.Errorf("%v: got zip %v for %v", tt.coords, zip, c)
+			}
+		}
+	}
+}
+
+// Calls sharing a rate limit start one interval apart, whatever the
+// number of callers.
+func TestRateLimitedResolver(t *testing.T) {
+	zips := NewRateLimitedResolver(fakeResolver{}, 50)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := zips.ZipCode(41.9, -87.6); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("5 calls at 50 a second took %v, want at least 80ms", elapsed)
+	}
+}
@@ -0,0 +1,129 @@
+package ingest
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/suebyeon/msds432_cbi/geo"
+)
+
+// zipBackfill describes a table whose rows carry zip codes resolved from
+// coordinates. Query selects the rows whose lookup failed after a serial
+// id, as (id, latitude, longitude, ...) with one coordinate pair per zip
+// column; Update sets those zip columns, keeping any that are already
+// known, and the resolution status. Filtering on the status alone lets
+// the partial index on resolution_status find the rows.
+type zipBackfill struct {
+	Table  string
+	Coords int
+	Query  string
+	Update string
+}
+
+var transportationBackfill = zipBackfill{
+	Table:  "transportation",
+	Coords: 2,
+	Query: `SELECT "id", "pickup_centroid_latitude", "pickup_centroid_longitude", "dropoff_centroid_latitude", "dropoff_centroid_longitude"
+		FROM transportation
+		WHERE "resolution_status" = 'failed'
+			AND "pickup_centroid_latitude" IS NOT NULL AND "dropoff_centroid_latitude" IS NOT NULL
+			AND "id" > $1
+		ORDER BY "id" LIMIT $2`,
+	Update: `UPDATE transportation SET "pickup_zip_code" = COALESCE($2, "pickup_zip_code"),
+		"dropoff_zip_code" = COALESCE($3, "dropoff_zip_code"), "resolution_status" = $4 WHERE "id" = $1`,
+}
+
+var permitBackfill = zipBackfill{
+	Table:  "permit",
+	Coords: 1,
+	Query: `SELECT "serial_id", "latitude", "longitude"
+		FROM permit
+		WHERE "resolution_status" = 'failed'
+			AND "latitude" IS NOT NULL
+			AND "serial_id" > $1
+		ORDER BY "serial_id" LIMIT $2`,
+	Update: `UPDATE permit SET "zip_code" = COALESCE($2, "zip_code"), "resolution_status" = $3 WHERE "serial_id" = $1`,
+}
+
+// ResolveMissingZips retries zip code resolution for trips and permits
+// whose lookup failed, on a quota or transport error, and updates them in
+// place. Rows the geocoder answered without a zip code, with no_result or
+// no_postal_code, are not retried: asking again costs a paid lookup for
+// the same answer. Fetched counts the rows retried and Inserted the rows
+// that are now fully resolved; rows that are still unresolved are counted
+// in Skipped by status.
+func (c *Collector) ResolveMissingZips() (RunStats, error) {
+	fmt.Println("ResolveMissingZips: Re-resolving rows whose zip code lookup failed")
+
+	stats := newRunStats(0)
+	for _, b := range []zipBackfill{transportationBackfill, permitBackfill} {
+		if err := b.run(c, &stats); err != nil {
+			return stats, fmt.Errorf("%s: %v", b.Table, err)
+		}
+	}
+
+	fmt.Printf("Re-resolved %d of %d rows whose zip code lookup failed\n", stats.Inserted, stats.Fetched)
+	return stats, nil
+}
+
+// run walks the failed rows a page at a time in id order, so rows that
+// stay unresolved are not read twice in one run.
+func (b zipBackfill) run(c *Collector, stats *RunStats) error {
+	var after int64
+	for {
+		ids, requests, err := b.page(c.DB, after, c.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		after = ids[len(ids)-1]
+		stats.Fetched += len(ids)
+
+		err = geo.Resolve(c.Zips, c.Workers, requests, func(res geo.Result) error {
+			status := res.Status()
+			if status == geo.ResolvedStatus {
+				stats.Inserted++
+			} else {
+				stats.skip("unresolved_" + status)
+			}
+
+			args := []interface{}{ids[res.Index]}
+			for i := range res.Zips {
+				args = append(args, res.Zip(i))
+			}
+			args = append(args, status)
+			_, err := c.DB.Exec(b.Update, args...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (b zipBackfill) page(db *sql.DB, after int64, limit int) ([]int64, []geo.Request, error) {
+	rows, err := db.Query(b.Query, after, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var requests []geo.Request
+	for rows.Next() {
+		var id int64
+		coords := make([]geo.LatLon, b.Coords)
+		dest := []interface{}{&id}
+		for i := range coords {
+			dest = append(dest, &coords[i].Latitude, &coords[i].Longitude)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		requests = append(requests, geo.Request{Index: len(ids), Coords: coords})
+		ids = append(ids, id)
+	}
+	return ids, requests, rows.Err()
+}
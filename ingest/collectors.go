@@ -0,0 +1,802 @@
+// Package ingest loads the Chicago Data Portal datasets the reports are
+// built from. Collectors fetch a dataset through a Source, drop records
+// they cannot use, resolve zip codes where needed and upsert the rest; the
+// Scheduler reruns them and records each run.
+package ingest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/suebyeon/msds432_cbi/geo"
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+type Boundaries []struct {
+	CommunityArea string          `json:"objectid"`
+	ZipCode       string          `json:"zip"`
+	The_geom      json.RawMessage `json:"the_geom"`
+}
+
+type CommunityAreaRecords []struct {
+	Area_number string          `json:"area_numbe"`
+	Community   string          `json:"community"`
+	The_geom    json.RawMessage `json:"the_geom"`
+}
+
+type TripsJsonRecords []struct {
+	Trip_id                    string `json:"trip_id"`
+	Trip_start_timestamp       string `json:"trip_start_timestamp"`
+	Trip_end_timestamp         string `json:"trip_end_timestamp"`
+	Pickup_centroid_latitude   string `json:"pickup_centroid_latitude"`
+	Pickup_centroid_longitude  string `json:"pickup_centroid_longitude"`
+	Dropoff_centroid_latitude  string `json:"dropoff_centroid_latitude"`
+	Dropoff_centroid_longitude string `json:"dropoff_centroid_longitude"`
+}
+
+type UnemploymentRecords []struct {
+	Community_area      string `json:"community_area"`
+	Below_poverty_level string `json:"below_poverty_level"`
+	Per_capita_income   string `json:"per_capita_income"`
+	Unemployment        string `json:"unemployment"`
+}
+
+type PermitRecords []struct {
+	ID             string `json:"id"`
+	Permit_type    string `json:"permit_type"`
+	Community_area string `json:"community_area"`
+	Latitude       string `json:"latitude"`
+	Longitude      string `json:"longitude"`
+	Issue_date     string `json:"issue_date"`
+}
+
+type CCCVIRecords []struct {
+	Geography_type        string `json:"geography_type"`
+	Community_area_or_zip string `json:"community_area_or_zip"`
+	Community_area_name   string `json:"community_area_name"`
+	Ccvi_category         string `json:"ccvi_category"`
+}
+
+type CovidRecords []struct {
+	Zip_code         string `json:"zip_code"`
+	Week_number      string `json:"week_number"`
+	Tests            string `json:"tests_weekly"`
+	Percent_positive string `json:"percent_tested_positive_weekly"`
+	Week_start       string `json:"week_start"`
+}
+
+// Collector runs the collectors against one database. Each Get method
+// loads one dataset, or for GetTrips both trip datasets, and reports what
+// it did with the records it fetched.
+type Collector struct {
+	DB     *sql.DB
+	Source Source
+
+	// Zips resolves the zip codes of trips and permits.
+	Zips geo.ZipResolver
+
+	// SODA sets the page size of each dataset and the row cap.
+	SODA SODAConfig
+
+	// BatchSize is how many rows bulk loads commit per transaction.
+	BatchSize int
+
+	// Workers is how many zip code lookups run at once.
+	Workers int
+
+	// Since, a SODA floating timestamp, makes the incremental collectors
+	// load records from that time instead of from their watermark, to
+	// reload a period. Datasets loaded whole ignore it.
+	Since string
+}
+
+// Runs returns the run function of every scheduled job, by job name.
+func (c *Collector) Runs() map[string]func() (RunStats, error) {
+	return map[string]func() (RunStats, error){
+		BoundariesJob:     c.GetBoundaries,
+		TripsJob:          c.GetTrips,
+		UnemploymentJob:   c.GetUnemploymentRates,
+		PermitsJob:        c.GetBuildingPermits,
+		CovidJob:          c.GetCovidDetails,
+		CCVIJob:           c.GetCCVIDetails,
+		CommunityAreasJob: c.GetCommunityAreas,
+
+		// Not a collector: retries zip code lookups that failed.
+		GeocodeBackfillJob: c.ResolveMissingZips,
+	}
+}
+
+func (c *Collector) GetBoundaries() (RunStats, error) {
+
+	fmt.Println("GetBoundaries: Collecting Boundaries Data")
+
+	var boundaries Boundaries
+	_, err := c.fetchPages(BoundariesDataset, ":id", "", func(body []byte) (int, error) {
+		var page Boundaries
+		err := json.Unmarshal(body, &page)
+		boundaries = append(boundaries, page...)
+		return len(page), err
+	})
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	fmt.Println("Boundaries: Received data from SODA REST API for Boundaries")
+
+	s := fmt.Sprintf("\n\n Boundaries number of SODA records received = %d\n\n", len(boundaries))
+	io.WriteString(os.Stdout, s)
+
+	stats := newRunStats(len(boundaries))
+
+	for i := 0; i < len(boundaries); i++ {
+		community_area := boundaries[i].CommunityArea
+		zip_code := boundaries[i].ZipCode
+		the_geom := store.GeometryText(boundaries[i].The_geom)
+
+		sql := `INSERT INTO boundaries ("community_area", "zip_code", "the_geom") values($1, $2, $3)
+			ON CONFLICT ("community_area", "zip_code") DO UPDATE SET "the_geom" = EXCLUDED."the_geom"`
+
+		_, err = c.DB.Exec(
+			sql,
+			community_area,
+			zip_code,
+			the_geom)
+
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Inserted++
+	}
+
+	fmt.Println("Completed Inserting Rows into the boundaries Table")
+
+	return stats, nil
+}
+
+var transportationUpsert = store.UpsertSpec{
+	Table: "transportation",
+	Columns: []string{"trip_id", "trip_start_timestamp", "trip_end_timestamp", "pickup_centroid_latitude", "pickup_centroid_longitude",
+		"dropoff_centroid_latitude", "dropoff_centroid_longitude", "pickup_zip_code", "dropoff_zip_code", "resolution_status"},
+	Key: []string{"trip_id"},
+}
+
+func (c *Collector) GetCommunityAreas() (RunStats, error) {
+	fmt.Println("GetCommunityAreas: Collecting Community Area Boundaries")
+
+	var area_list CommunityAreaRecords
+	_, err := c.fetchPages(CommunityAreasDataset, ":id", "", func(body []byte) (int, error) {
+		var page CommunityAreaRecords
+		err := json.Unmarshal(body, &page)
+		area_list = append(area_list, page...)
+		return len(page), err
+	})
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	fmt.Println("Received data from SODA REST API for Community Areas")
+
+	s := fmt.Sprintf("\n\n Community Areas: number of SODA records received = %d\n\n", len(area_list))
+	io.WriteString(os.Stdout, s)
+
+	stats := newRunStats(len(area_list))
+
+	for i := 0; i < len(area_list); i++ {
+
+		community_area := area_list[i].Area_number
+		if community_area == "" {
+			stats.skip("missing_area_number")
+			continue
+		}
+
+		the_geom := store.GeometryText(area_list[i].The_geom)
+		if !the_geom.Valid {
+			stats.skip("missing_the_geom")
+			continue
+		}
+
+		sql := `INSERT INTO community_areas ("community_area", "community", "the_geom") values($1, $2, $3)
+			ON CONFLICT ("community_area") DO UPDATE SET
+			"community" = EXCLUDED."community", "the_geom" = EXCLUDED."the_geom"`
+
+		_, err = c.DB.Exec(
+			sql,
+			community_area,
+			area_list[i].Community,
+			the_geom)
+
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Inserted++
+
+	}
+
+	fmt.Println("Completed Inserting Rows into the Community Areas Table")
+
+	return stats, nil
+}
+
+func (c *Collector) GetTrips() (RunStats, error) {
+
+	fmt.Println("GetTaxiTrips: Collecting Taxi Trips Data")
+
+	// Only fetch trips that started at or after the last trip loaded, or
+	// c.Since.
+	taxi_watermark, err := c.startFrom(TaxiTripsDataset)
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	tnp_watermark, err := c.startFrom(TNPTripsDataset)
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	var taxi_trips_list_1 TripsJsonRecords
+	_, err = c.fetchPages(TaxiTripsDataset, "trip_start_timestamp,:id", sinceWatermark("trip_start_timestamp", taxi_watermark), func(body []byte) (int, error) {
+		var page TripsJsonRecords
+		err := json.Unmarshal(body, &page)
+		taxi_trips_list_1 = append(taxi_trips_list_1, page...)
+		return len(page), err
+	})
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	fmt.Println("Received data from SODA REST API for Taxi Trips")
+
+	// Get the Taxi Trip list for rideshare companies like Uber/Lyft list
+	// Transportation-Network-Providers-Trips:
+	var taxi_trips_list_2 TripsJsonRecords
+	_, err = c.fetchPages(TNPTripsDataset, "trip_start_timestamp,:id", sinceWatermark("trip_start_timestamp", tnp_watermark), func(body []byte) (int, error) {
+		var page TripsJsonRecords
+		err := json.Unmarshal(body, &page)
+		taxi_trips_list_2 = append(taxi_trips_list_2, page...)
+		return len(page), err
+	})
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	fmt.Println("Received data from SODA REST API for Transportation-Network-Providers-Trips")
+
+	s := fmt.Sprintf("\n\n Transportation-Network-Providers-Trips number of SODA records received = %d\n\n", len(taxi_trips_list_2))
+	io.WriteString(os.Stdout, s)
+
+	// Add the Taxi medallions list & rideshare companies like Uber/Lyft list
+
+	taxi_trips_list := append(taxi_trips_list_1, taxi_trips_list_2...)
+
+	// Process the list
+
+	stats := newRunStats(len(taxi_trips_list))
+
+	// Trips are loaded in batches with COPY; see store.BatchLoader.
+	loader := store.NewBatchLoader(c.DB, transportationUpsert, c.BatchSize)
+
+	var requests []geo.Request
+	for i := 0; i < len(taxi_trips_list); i++ {
+
+		trip_id := taxi_trips_list[i].Trip_id
+		if trip_id == "" {
+			stats.skip("missing_trip_id")
+			continue
+		}
+
+		// get Trip_start_timestamp
+		trip_start_timestamp := taxi_trips_list[i].Trip_start_timestamp
+		if len(trip_start_timestamp) < 23 {
+			stats.skip("invalid_trip_start_timestamp")
+			continue
+		}
+
+		// get Trip_end_timestamp
+		trip_end_timestamp := taxi_trips_list[i].Trip_end_timestamp
+		if len(trip_end_timestamp) < 23 {
+			stats.skip("invalid_trip_end_timestamp")
+			continue
+		}
+
+		pickup_centroid_latitude := taxi_trips_list[i].Pickup_centroid_latitude
+
+		if pickup_centroid_latitude == "" {
+			stats.skip("missing_pickup_centroid_latitude")
+			continue
+		}
+
+		pickup_centroid_longitude := taxi_trips_list[i].Pickup_centroid_longitude
+
+		if pickup_centroid_longitude == "" {
+			stats.skip("missing_pickup_centroid_longitude")
+			continue
+		}
+
+		dropoff_centroid_latitude := taxi_trips_list[i].Dropoff_centroid_latitude
+
+		if dropoff_centroid_latitude == "" {
+			stats.skip("missing_dropoff_centroid_latitude")
+			continue
+		}
+
+		dropoff_centroid_longitude := taxi_trips_list[i].Dropoff_centroid_longitude
+
+		if dropoff_centroid_longitude == "" {
+			stats.skip("missing_dropoff_centroid_longitude")
+			continue
+		}
+
+		pickup_centroid_latitude_float, err := strconv.ParseFloat(pickup_centroid_latitude, 64)
+		if err != nil {
+			stats.skip("invalid_pickup_centroid_latitude")
+			continue
+		}
+
+		pickup_centroid_longitude_float, err := strconv.ParseFloat(pickup_centroid_longitude, 64)
+		if err != nil {
+			stats.skip("invalid_pickup_centroid_longitude")
+			continue
+		}
+
+		dropoff_centroid_latitude_float, err := strconv.ParseFloat(dropoff_centroid_latitude, 64)
+		if err != nil {
+			stats.skip("invalid_dropoff_centroid_latitude")
+			continue
+		}
+
+		dropoff_centroid_longitude_float, err := strconv.ParseFloat(dropoff_centroid_longitude, 64)
+		if err != nil {
+			stats.skip("invalid_dropoff_centroid_longitude")
+			continue
+		}
+
+		requests = append(requests, geo.Request{Index: i, Coords: []geo.LatLon{
+			{Latitude: pickup_centroid_latitude_float, Longitude: pickup_centroid_longitude_float},
+			{Latitude: dropoff_centroid_latitude_float, Longitude: dropoff_centroid_longitude_float},
+		}})
+	}
+
+	// Pickup and dropoff zip codes are looked up by a pool of workers; the
+	// results are written here, one trip at a time. A trip whose zip codes
+	// could not be resolved is still stored, with null zip codes and its
+	// resolution_status, so it can be re-resolved later.
+	unresolved := 0
+	err = geo.Resolve(c.Zips, c.Workers, requests, func(res geo.Result) error {
+		status := res.Status()
+		if status != geo.ResolvedStatus {
+			unresolved++
+		}
+
+		trip := taxi_trips_list[res.Index]
+		return loader.Add(
+			trip.Trip_id,
+			trip.Trip_start_timestamp,
+			trip.Trip_end_timestamp,
+			trip.Pickup_centroid_latitude,
+			trip.Pickup_centroid_longitude,
+			trip.Dropoff_centroid_latitude,
+			trip.Dropoff_centroid_longitude,
+			res.Zip(0),
+			res.Zip(1),
+			status)
+	})
+	if err != nil {
+		stats.Inserted = loader.Loaded()
+		return stats, err
+	}
+
+	if err := loader.Flush(); err != nil {
+		stats.Inserted = loader.Loaded()
+		return stats, err
+	}
+	stats.Inserted = loader.Loaded()
+
+	fmt.Printf("Completed Inserting Rows into the TaxiTrips Table (%d without zip codes)\n", unresolved)
+
+	// Advance the high-water marks now that the fetched trips are stored.
+	for _, trip := range taxi_trips_list_1 {
+		if trip.Trip_start_timestamp > taxi_watermark {
+			taxi_watermark = trip.Trip_start_timestamp
+		}
+	}
+	for _, trip := range taxi_trips_list_2 {
+		if trip.Trip_start_timestamp > tnp_watermark {
+			tnp_watermark = trip.Trip_start_timestamp
+		}
+	}
+
+	if err := saveWatermark(c.DB, TaxiTripsDataset, taxi_watermark); err != nil {
+		return stats, err
+	}
+	if err := saveWatermark(c.DB, TNPTripsDataset, tnp_watermark); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+func (c *Collector) GetUnemploymentRates() (RunStats, error) {
+	fmt.Println("GetCommunityAreaUnemployment: Collecting Unemployment Rates Data")
+
+	// There are 77 known community areas in the data set
+	// So, a single page at the default size of 100 holds all of them.
+	var unemployment_data_list UnemploymentRecords
+	_, err := c.fetchPages(UnemploymentDataset, ":id", "", func(body []byte) (int, error) {
+		var page UnemploymentRecords
+		err := json.Unmarshal(body, &page)
+		unemployment_data_list = append(unemployment_data_list, page...)
+		return len(page), err
+	})
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	fmt.Println("Community Areas Unemplyment: Received data from SODA REST API for Unemployment")
+
+	s := fmt.Sprintf("\n\n Community Areas number of SODA records received = %d\n\n", len(unemployment_data_list))
+	io.WriteString(os.Stdout, s)
+
+	stats := newRunStats(len(unemployment_data_list))
+
+	for i := 0; i < len(unemployment_data_list); i++ {
+
+		// We will execute defensive coding to check for messy/dirty/missing data values
+		// There are different methods to deal with messy/dirty/missing data.
+		// We will use the simplest method: drop records that have messy/dirty/missing data
+		// Any record that has messy/dirty/missing data we don't enter it in the data lake/table
+
+		community_area := unemployment_data_list[i].Community_area
+		if community_area == "" {
+			stats.skip("missing_community_area")
+			continue
+		}
+
+		below_poverty_level, err := strconv.ParseFloat(unemployment_data_list[i].Below_poverty_level, 64)
+		if err != nil {
+			stats.skip("invalid_below_poverty_level")
+			continue
+		}
+
+		per_capita_income, err := strconv.Atoi(unemployment_data_list[i].Per_capita_income)
+		if err != nil {
+			stats.skip("invalid_per_capita_income")
+			continue // Skip the record if conversion fails
+		}
+
+		unemployment, err := strconv.ParseFloat(unemployment_data_list[i].Unemployment, 64)
+		if err != nil {
+			stats.skip("invalid_unemployment")
+			continue
+		}
+
+		sql := `INSERT INTO unemployment ("community_area", "below_poverty_level", "per_capita_income", "unemployment") values($1, $2, $3, $4)
+			ON CONFLICT ("community_area") DO UPDATE SET
+			"below_poverty_level" = EXCLUDED."below_poverty_level", "per_capita_income" = EXCLUDED."per_capita_income", "unemployment" = EXCLUDED."unemployment"`
+
+		_, err = c.DB.Exec(
+			sql,
+			community_area,
+			below_poverty_level,
+			per_capita_income,
+			unemployment)
+
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Inserted++
+
+	}
+
+	fmt.Println("Completed Inserting Rows into the community_area_unemployment Table")
+
+	return stats, nil
+}
+
+var permitUpsert = store.UpsertSpec{
+	Table:   "permit",
+	Columns: []string{"id", "permit_type", "issue_date", "community_area", "latitude", "longitude", "zip_code", "resolution_status"},
+	Key:     []string{"id"},
+}
+
+func (c *Collector) GetBuildingPermits() (RunStats, error) {
+	fmt.Println("GetBuildingPermits: Collecting Building Permits Data")
+
+	// Only fetch permits issued on or after the last permit loaded.
+	watermark, err := c.startFrom(BuildingPermitsDataset)
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	var building_data_list PermitRecords
+	_, err = c.fetchPages(BuildingPermitsDataset, "issue_date,:id", sinceWatermark("issue_date", watermark), func(body []byte) (int, error) {
+		var page PermitRecords
+		err := json.Unmarshal(body, &page)
+		building_data_list = append(building_data_list, page...)
+		return len(page), err
+	})
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	fmt.Println("Received data from SODA REST API for Building Permits")
+
+	s := fmt.Sprintf("\n\n Building Permits: number of SODA records received = %d\n\n", len(building_data_list))
+	io.WriteString(os.Stdout, s)
+
+	stats := newRunStats(len(building_data_list))
+
+	// Permits are loaded in batches with COPY; see store.BatchLoader.
+	loader := store.NewBatchLoader(c.DB, permitUpsert, c.BatchSize)
+
+	var requests []geo.Request
+	for i := 0; i < len(building_data_list); i++ {
+
+		id := building_data_list[i].ID
+		if id == "" {
+			stats.skip("missing_id")
+			continue
+		}
+
+		permit_type := building_data_list[i].Permit_type
+		if permit_type == "" {
+			stats.skip("missing_permit_type")
+			continue
+		}
+
+		_, err = strconv.Atoi(building_data_list[i].Community_area)
+		if err != nil {
+			stats.skip("invalid_community_area")
+			continue
+		}
+
+		latitude := building_data_list[i].Latitude
+		if latitude == "" {
+			stats.skip("missing_latitude")
+			continue
+		}
+
+		longitude := building_data_list[i].Longitude
+		if longitude == "" {
+			stats.skip("missing_longitude")
+			continue
+		}
+
+		latitude_float, err := strconv.ParseFloat(latitude, 64)
+		if err != nil {
+			fmt.Printf("Error parsing latitude for record %d: %v\n", i, err)
+			stats.skip("invalid_latitude")
+			continue
+		}
+
+		longitude_float, err := strconv.ParseFloat(longitude, 64)
+		if err != nil {
+			fmt.Printf("Error parsing longitude for record %d: %v\n", i, err)
+			stats.skip("invalid_longitude")
+			continue
+		}
+
+		requests = append(requests, geo.Request{Index: i, Coords: []geo.LatLon{{Latitude: latitude_float, Longitude: longitude_float}}})
+	}
+
+	// Zip codes are looked up by a pool of workers; the results are written
+	// here, one permit at a time. Unresolved permits are stored with a null
+	// zip code and their resolution_status.
+	unresolved := 0
+	err = geo.Resolve(c.Zips, c.Workers, requests, func(res geo.Result) error {
+		status := res.Status()
+		if status != geo.ResolvedStatus {
+			fmt.Printf("Error resolving zip code for record %d: %v\n", res.Index, res.Errs[0])
+			unresolved++
+		}
+
+		permit := building_data_list[res.Index]
+		community_area, _ := strconv.Atoi(permit.Community_area)
+		return loader.Add(
+			permit.ID,
+			permit.Permit_type,
+			sql.NullString{String: permit.Issue_date, Valid: permit.Issue_date != ""},
+			community_area,
+			permit.Latitude,
+			permit.Longitude,
+			res.Zip(0),
+			status)
+	})
+	if err != nil {
+		stats.Inserted = loader.Loaded()
+		return stats, err
+	}
+
+	if err := loader.Flush(); err != nil {
+		stats.Inserted = loader.Loaded()
+		return stats, err
+	}
+	stats.Inserted = loader.Loaded()
+
+	fmt.Printf("Completed Inserting Rows into the Building Permits Table (%d without zip codes)\n", unresolved)
+
+	for _, permit := range building_data_list {
+		if permit.Issue_date > watermark {
+			watermark = permit.Issue_date
+		}
+	}
+
+	if err := saveWatermark(c.DB, BuildingPermitsDataset, watermark); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+func (c *Collector) GetCovidDetails() (RunStats, error) {
+	fmt.Println("GetCovidDetails: Collecting Covid Data")
+
+	// Page through the dataset at its configured page size; SODA_MAX_ROWS
+	// caps the total.
+	// Only fetch weeks starting on or after the last week loaded.
+	watermark, err := c.startFrom(CovidDataset)
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	var covid_list CovidRecords
+	_, err = c.fetchPages(CovidDataset, "week_start,:id", sinceWatermark("week_start", watermark), func(body []byte) (int, error) {
+		var page CovidRecords
+		err := json.Unmarshal(body, &page)
+		covid_list = append(covid_list, page...)
+		return len(page), err
+	})
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	fmt.Println("Received data from SODA REST API for Covid")
+
+	s := fmt.Sprintf("\n\n Covid: number of SODA records received = %d\n\n", len(covid_list))
+	io.WriteString(os.Stdout, s)
+
+	stats := newRunStats(len(covid_list))
+
+	for i := 0; i < len(covid_list); i++ {
+
+		zip_code := covid_list[i].Zip_code
+		if zip_code == "" {
+			stats.skip("missing_zip_code")
+			continue
+		}
+
+		week_number, err := strconv.Atoi(covid_list[i].Week_number)
+		if err != nil {
+			stats.skip("invalid_week_number")
+			continue
+		}
+
+		tests_weekly, err := strconv.Atoi(covid_list[i].Tests)
+		if err != nil {
+			stats.skip("invalid_tests_weekly")
+			continue
+		}
+
+		percent_tested_positive_weekly := covid_list[i].Percent_positive
+		if percent_tested_positive_weekly == "" {
+			stats.skip("missing_percent_tested_positive_weekly")
+			continue
+		}
+
+		sql := `INSERT INTO covid ("zip_code" ,"week_number", "tests", "percentage_positive") values($1, $2, $3, $4)
+			ON CONFLICT ("zip_code", "week_number") DO UPDATE SET
+			"tests" = EXCLUDED."tests", "percentage_positive" = EXCLUDED."percentage_positive"`
+
+		_, err = c.DB.Exec(
+			sql,
+			zip_code,
+			week_number,
+			tests_weekly,
+			percent_tested_positive_weekly)
+
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Inserted++
+
+	}
+
+	fmt.Println("Completed Inserting Rows into the Covid Table")
+
+	for _, week := range covid_list {
+		if week.Week_start > watermark {
+			watermark = week.Week_start
+		}
+	}
+
+	if err := saveWatermark(c.DB, CovidDataset, watermark); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+func (c *Collector) GetCCVIDetails() (RunStats, error) {
+	fmt.Println("GetCCVIDetails: Collecting CCVI Data")
+
+	// Page through the dataset at its configured page size; SODA_MAX_ROWS
+	// caps the total.
+	var ccvi_list CCCVIRecords
+	_, err := c.fetchPages(CCVIDataset, ":id", "", func(body []byte) (int, error) {
+		var page CCCVIRecords
+		err := json.Unmarshal(body, &page)
+		ccvi_list = append(ccvi_list, page...)
+		return len(page), err
+	})
+	if err != nil {
+		return RunStats{}, err
+	}
+
+	fmt.Println("Received data from SODA REST API for CCVI")
+
+	s := fmt.Sprintf("\n\n CCVI: number of SODA records received = %d\n\n", len(ccvi_list))
+	io.WriteString(os.Stdout, s)
+
+	stats := newRunStats(len(ccvi_list))
+
+	for i := 0; i < len(ccvi_list); i++ {
+
+		// We will execute defensive coding to check for messy/dirty/missing data values
+		// There are different methods to deal with messy/dirty/missing data.
+		// We will use the simplest method: drop records that have messy/dirty/missing data
+		// Any record that has messy/dirty/missing data we don't enter it in the data lake/table
+
+		geography_type := ccvi_list[i].Geography_type
+		if geography_type == "" {
+			stats.skip("missing_geography_type")
+			continue
+		}
+
+		community_area_or_zip, err := strconv.Atoi(ccvi_list[i].Community_area_or_zip)
+		if err != nil {
+			stats.skip("invalid_community_area_or_zip")
+			continue
+		}
+
+		community_area_name := ccvi_list[i].Community_area_name
+		if community_area_name == "" {
+			stats.skip("missing_community_area_name")
+			continue
+		}
+
+		ccvi_category := ccvi_list[i].Ccvi_category
+		if ccvi_category == "" {
+			stats.skip("missing_ccvi_category")
+			continue
+		}
+
+		sql := `INSERT INTO ccvi ("geography_type", "community_area_or_zip", "community_area_name", "ccvi_category") values($1, $2, $3, $4)
+			ON CONFLICT ("community_area_or_zip", "geography_type") DO UPDATE SET
+			"community_area_name" = EXCLUDED."community_area_name", "ccvi_category" = EXCLUDED."ccvi_category"`
+
+		_, err = c.DB.Exec(
+			sql,
+			geography_type,
+			community_area_or_zip,
+			community_area_name,
+			ccvi_category)
+
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Inserted++
+
+	}
+
+	fmt.Println("Completed Inserting Rows into the CCVI Table")
+
+	return stats, nil
+}
@@ -0,0 +1,45 @@
+package ingest
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/suebyeon/msds432_cbi/store"
+)
+
+// SummariesFedBy lists the summary tables to rebuild after each job. Every
+// job that loads data a report reads is listed, so that report's as-of
+// time moves with it.
+var SummariesFedBy = map[string][]store.SummaryTable{
+	TripsJob:           {store.TripCounts},
+	GeocodeBackfillJob: {store.TripCounts},
+	PermitsJob:         {store.PermitCounts},
+	CovidJob:           {store.CovidCases},
+	CCVIJob:            {store.CCVIZipCodes},
+	BoundariesJob:      {store.CCVIZipCodes},
+	UnemploymentJob:    {store.Unemployment},
+}
+
+// RefreshAfter wraps a job's run so that the summaries it feeds are
+// rebuilt when it succeeds. A failed rebuild fails the run, so it is
+// retried with the job.
+func RefreshAfter(db *sql.DB, run func() (RunStats, error), summaries []store.SummaryTable) func() (RunStats, error) {
+	if len(summaries) == 0 {
+		return run
+	}
+	return func() (RunStats, error) {
+		stats, err := run()
+		if err != nil {
+			return stats, err
+		}
+		for _, s := range summaries {
+			start := time.Now()
+			if err := s.Refresh(db); err != nil {
+				return stats, err
+			}
+			log.Printf("refreshed %s in %s", s.Name, time.Since(start))
+		}
+		return stats, nil
+	}
+}
@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// RunStats counts what a collector run did with the records it fetched.
+type RunStats struct {
+	Fetched  int            `json:"records_fetched"`
+	Inserted int            `json:"records_inserted"`
+	Skipped  map[string]int `json:"records_skipped"`
+}
+
+func newRunStats(fetched int) RunStats {
+	return RunStats{Fetched: fetched, Skipped: map[string]int{}}
+}
+
+// skip counts a record that was dropped, keyed by why.
+func (s *RunStats) skip(reason string) {
+	if s.Skipped == nil {
+		s.Skipped = map[string]int{}
+	}
+	s.Skipped[reason]++
+}
+
+// IngestionRun is one row of the ingestion_runs table.
+type IngestionRun struct {
+	ID         int64      `json:"id"`
+	Dataset    string     `json:"dataset"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	RunStats
+	Error string `json:"error,omitempty"`
+}
+
+// startRun records that a run of dataset has started and returns its id.
+func startRun(db *sql.DB, dataset string, startedAt time.Time) (int64, error) {
+	var id int64
+	err := db.QueryRow(`INSERT INTO ingestion_runs ("dataset", "started_at") values($1, $2) RETURNING "id"`,
+		dataset, startedAt).Scan(&id)
+	return id, err
+}
+
+// finishRun records the outcome of the run started by startRun.
+func finishRun(db *sql.DB, id int64, finishedAt time.Time, stats RunStats, runErr error) error {
+	skipped, err := json.Marshal(stats.Skipped)
+	if err != nil {
+		return err
+	}
+	if stats.Skipped == nil {
+		skipped = []byte("{}")
+	}
+
+	var errText sql.NullString
+	if runErr != nil {
+		errText = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+
+	_, err = db.Exec(`UPDATE ingestion_runs SET "finished_at" = $2, "records_fetched" = $3, "records_inserted" = $4,
+		"records_skipped" = $5, "error" = $6 WHERE "id" = $1`,
+		id, finishedAt, stats.Fetched, stats.Inserted, string(skipped), errText)
+	return err
+}
+
+// LatestRuns returns the most recent run of each dataset.
+func LatestRuns(db *sql.DB) ([]IngestionRun, error) {
+	query := `
+		SELECT "id", "dataset", "started_at", "finished_at", "records_fetched", "records_inserted", "records_skipped", "error"
+		FROM ingestion_runs
+		WHERE "id" IN (SELECT MAX("id") FROM ingestion_runs GROUP BY "dataset")
+		ORDER BY "dataset";
+	`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []IngestionRun{}
+	for rows.Next() {
+		var run IngestionRun
+		var finishedAt sql.NullTime
+		var skipped []byte
+		var errText sql.NullString
+		err := rows.Scan(&run.ID, &run.Dataset, &run.StartedAt, &finishedAt, &run.Fetched, &run.Inserted, &skipped, &errText)
+		if err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		if err := json.Unmarshal(skipped, &run.Skipped); err != nil {
+			return nil, err
+		}
+		run.Error = errText.String
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,184 @@
+package ingest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Job names, the keys of Collector.Runs and of the configured schedules.
+const (
+	BoundariesJob     = "boundaries"
+	TripsJob          = "trips"
+	UnemploymentJob   = "unemployment"
+	PermitsJob        = "building_permits"
+	CovidJob          = "covid"
+	CCVIJob           = "ccvi"
+	CommunityAreasJob = "community_areas"
+
+	GeocodeBackfillJob = "geocode_backfill"
+)
+
+// Job is a collector the scheduler reruns on its schedule.
+type Job struct {
+	Name     string
+	Schedule cron.Schedule
+	Run      func() (RunStats, error)
+}
+
+// RetryPolicy says how often a failed run is retried and how long to wait
+// in between. The wait doubles after each failure, up to MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+func (p RetryPolicy) wait(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// Scheduler runs each job once at start and then on its schedule, and
+// records every attempt in ingestion_runs. A failed attempt is retried
+// with backoff; a job that still fails waits for its next scheduled run
+// while the other jobs and the HTTP server carry on. A job is never run
+// twice at the same time.
+type Scheduler struct {
+	db    *sql.DB
+	retry RetryPolicy
+	jobs  []Job
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func NewScheduler(db *sql.DB, retry RetryPolicy, jobs ...Job) *Scheduler {
+	return &Scheduler{
+		db:      db,
+		retry:   retry,
+		jobs:    jobs,
+		running: map[string]bool{},
+	}
+}
+
+// ParseSchedule accepts a Go duration such as "1h", a descriptor such as
+// "@daily" or "@every 30m", or a standard five-field cron expression.
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("schedule %q: interval must be positive", spec)
+		}
+		return cron.Every(d), nil
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %q: %v", spec, err)
+	}
+	return schedule, nil
+}
+
+// Start runs every job in its own goroutine and returns immediately.
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		go s.loop(job)
+	}
+}
+
+func (s *Scheduler) loop(job Job) {
+	for {
+		s.RunNow(job)
+
+		next := job.Schedule.Next(time.Now())
+		log.Printf("scheduler: next %s run at %s", job.Name, next.Format(time.RFC3339))
+		time.Sleep(time.Until(next))
+	}
+}
+
+// ErrJobRunning is returned by RunNow when a run of the same job is still in
+// progress.
+var ErrJobRunning = errors.New("job is still running")
+
+// RunNow runs job, retrying failed attempts, and records the result. It
+// returns the error of the last attempt, or ErrJobRunning without running
+// the job if a run of the same job is still in progress.
+func (s *Scheduler) RunNow(job Job) error {
+	s.mu.Lock()
+	if s.running[job.Name] {
+		s.mu.Unlock()
+		log.Printf("scheduler: %s is still running, skipping", job.Name)
+		return ErrJobRunning
+	}
+	s.running[job.Name] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.running[job.Name] = false
+		s.mu.Unlock()
+	}()
+
+	for attempt := 1; ; attempt++ {
+		err := s.attempt(job)
+		if err == nil {
+			return nil
+		}
+		if attempt >= s.retry.MaxAttempts {
+			log.Printf("scheduler: %s failed %d times, giving up until its next run", job.Name, attempt)
+			return err
+		}
+
+		wait := s.retry.wait(attempt)
+		log.Printf("scheduler: retrying %s in %s (attempt %d of %d)", job.Name, wait, attempt+1, s.retry.MaxAttempts)
+		time.Sleep(wait)
+	}
+}
+
+// attempt runs job once and records it in ingestion_runs.
+func (s *Scheduler) attempt(job Job) error {
+	start := time.Now()
+	id, err := startRun(s.db, job.Name, start)
+	if err != nil {
+		log.Printf("scheduler: recording start of %s: %v", job.Name, err)
+	}
+
+	stats, runErr := runRecovered(job)
+	end := time.Now()
+	if runErr != nil {
+		log.Printf("scheduler: %s failed after %s: %v", job.Name, end.Sub(start), runErr)
+	} else {
+		log.Printf("scheduler: %s fetched %d records, inserted %d, skipped %v in %s",
+			job.Name, stats.Fetched, stats.Inserted, stats.Skipped, end.Sub(start))
+	}
+
+	if id != 0 {
+		if err := finishRun(s.db, id, end, stats, runErr); err != nil {
+			log.Printf("scheduler: recording end of %s: %v", job.Name, err)
+		}
+	}
+	return runErr
+}
+
+// runRecovered turns a panic that escapes a collector into a failed run
+// instead of crashing the server.
+func runRecovered(job Job) (stats RunStats, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run()
+}
@@ -0,0 +1,226 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dataset names used by the collectors. Each name has a DatasetConfig in
+// SODAConfig.Datasets and maps to a <name>.json file for a FileSource.
+const (
+	BoundariesDataset      = "boundaries"
+	TaxiTripsDataset       = "taxi_trips"
+	TNPTripsDataset        = "tnp_trips"
+	UnemploymentDataset    = "unemployment"
+	BuildingPermitsDataset = "building_permits"
+	CovidDataset           = "covid"
+	CCVIDataset            = "ccvi"
+	CommunityAreasDataset  = "community_areas"
+)
+
+// SODAConfig says how the collectors page through the SODA datasets.
+type SODAConfig struct {
+	// FixtureDir replays recorded responses instead of calling the API.
+	FixtureDir string `json:"fixture_dir"`
+
+	// MaxRows caps how many rows are read from one dataset; 0 means no cap.
+	MaxRows int `json:"max_rows"`
+
+	Datasets map[string]DatasetConfig `json:"datasets"`
+}
+
+// DatasetConfig is where a dataset is served and how many rows are read
+// per request.
+type DatasetConfig struct {
+	URL      string `json:"url"`
+	PageSize int    `json:"page_size"`
+}
+
+// Source returns the raw JSON array for a dataset. params holds SODA query
+// parameters such as $limit.
+type Source interface {
+	Fetch(dataset string, params url.Values) ([]byte, error)
+}
+
+// SODASource fetches datasets from the Chicago Data Portal SODA API.
+type SODASource struct {
+	Datasets map[string]DatasetConfig
+	Client   *http.Client
+}
+
+func NewSODASource(datasets map[string]DatasetConfig) *SODASource {
+	tr := &http.Transport{
+		MaxIdleConns:          10,
+		IdleConnTimeout:       1000 * time.Second,
+		TLSHandshakeTimeout:   1000 * time.Second,
+		ExpectContinueTimeout: 1000 * time.Second,
+		DisableCompression:    true,
+		Dial: (&net.Dialer{
+			Timeout:   1000 * time.Second,
+			KeepAlive: 1000 * time.Second,
+		}).Dial,
+		ResponseHeaderTimeout: 1000 * time.Second,
+	}
+
+	return &SODASource{
+		Datasets: datasets,
+		Client:   &http.Client{Transport: tr},
+	}
+}
+
+func (s *SODASource) Fetch(dataset string, params url.Values) ([]byte, error) {
+	ds, ok := s.Datasets[dataset]
+	if !ok {
+		return nil, fmt.Errorf("soda: unknown dataset %q", dataset)
+	}
+	endpoint := ds.URL
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	res, err := s.Client.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("soda: %s returned %s", dataset, res.Status)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// FileSource serves recorded SODA responses from Dir, one <dataset>.json
+// file per dataset. $offset and $limit are applied to the recorded array so
+// a captured day of data can be replayed the same way the API serves it. The
+// only $where it understands is the watermark filter, field >= 'value',
+// which keeps the records whose field compares at or after value as text;
+// records are served in the order they were recorded, whatever the $order.
+type FileSource struct {
+	Dir string
+}
+
+func (s *FileSource) Fetch(dataset string, params url.Values) ([]byte, error) {
+	body, err := ioutil.ReadFile(filepath.Join(s.Dir, dataset+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, fmt.Errorf("fixture %s: %v", dataset, err)
+	}
+	if v := params.Get("$where"); v != "" {
+		if records, err = filterSince(records, v); err != nil {
+			return nil, fmt.Errorf("fixture %s: %v", dataset, err)
+		}
+	}
+
+	offset, limit := 0, len(records)
+	if v := params.Get("$offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("fixture %s: bad $offset %q", dataset, v)
+		}
+	}
+	if v := params.Get("$limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("fixture %s: bad $limit %q", dataset, v)
+		}
+	}
+
+	if offset > len(records) {
+		offset = len(records)
+	}
+	if offset+limit > len(records) {
+		limit = len(records) - offset
+	}
+
+	return json.Marshal(records[offset : offset+limit])
+}
+
+// sinceFilter matches the $where clause built by sinceWatermark.
+var sinceFilter = regexp.MustCompile(`^(\w+) >= '((?:[^']|'')*)'$`)
+
+// filterSince keeps the records that where, a watermark filter, selects.
+// A record without the field, or with a value that is not a string, is
+// dropped, as SoQL drops a null in a comparison.
+func filterSince(records []json.RawMessage, where string) ([]json.RawMessage, error) {
+	m := sinceFilter.FindStringSubmatch(where)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported $where %q", where)
+	}
+	field, since := m[1], strings.ReplaceAll(m[2], "''", "'")
+
+	kept := []json.RawMessage{}
+	for _, raw := range records {
+		var record map[string]interface{}
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return nil, err
+		}
+		if v, ok := record[field].(string); ok && v >= since {
+			kept = append(kept, raw)
+		}
+	}
+	return kept, nil
+}
+
+// fetchPages pages through dataset with $limit/$offset in a stable $order
+// until a short page comes back or c.SODA.MaxRows rows have been read.
+// where, if set, is passed as the SODA $where filter. decode is called with
+// each page body and returns how many records it held.
+func (c *Collector) fetchPages(dataset, order, where string, decode func(body []byte) (int, error)) (int, error) {
+	pageSize := c.SODA.Datasets[dataset].PageSize
+	maxRows := c.SODA.MaxRows
+	if pageSize <= 0 {
+		return 0, fmt.Errorf("%s: no page size configured", dataset)
+	}
+
+	total := 0
+	for page := 1; ; page++ {
+		limit := pageSize
+		if maxRows > 0 && total+limit > maxRows {
+			limit = maxRows - total
+		}
+		if limit <= 0 {
+			log.Printf("%s: reached maximum of %d rows", dataset, maxRows)
+			return total, nil
+		}
+
+		params := url.Values{
+			"$limit":  {strconv.Itoa(limit)},
+			"$offset": {strconv.Itoa(total)},
+			"$order":  {order},
+		}
+		if where != "" {
+			params.Set("$where", where)
+		}
+
+		body, err := c.Source.Fetch(dataset, params)
+		if err != nil {
+			return total, err
+		}
+
+		n, err := decode(body)
+		if err != nil {
+			return total, fmt.Errorf("%s: page %d: %v", dataset, page, err)
+		}
+		total += n
+
+		log.Printf("%s: page %d offset %d received %d records (%d total)", dataset, page, total-n, n, total)
+
+		if n < limit {
+			return total, nil
+		}
+	}
+}
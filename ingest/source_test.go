@@ -0,0 +1,47 @@
+package ingest
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSourceWhere(t *testing.T) {
+	dir := t.TempDir()
+	records := `[
+		{"trip_id": "a", "trip_start_timestamp": "2023-01-02T23:00:00.000"},
+		{"trip_id": "b", "trip_start_timestamp": "2023-01-03T00:00:00.000"},
+		{"trip_id": "c"},
+		{"trip_id": "d", "trip_start_timestamp": "2023-01-04T12:00:00.000"}
+	]`
+	if err := ioutil.WriteFile(filepath.Join(dir, TaxiTripsDataset+".json"), []byte(records), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := &FileSource{Dir: dir}
+
+	tests := []struct {
+		params url.Values
+		want   string
+	}{
+		{url.Values{}, `[{"trip_id":"a","trip_start_timestamp":"2023-01-02T23:00:00.000"},{"trip_id":"b","trip_start_timestamp":"2023-01-03T00:00:00.000"},{"trip_id":"c"},{"trip_id":"d","trip_start_timestamp":"2023-01-04T12:00:00.000"}]`},
+		{url.Values{"$where": {sinceWatermark("trip_start_timestamp", "2023-01-03T00:00:00.000")}},
+			`[{"trip_id":"b","trip_start_timestamp":"2023-01-03T00:00:00.000"},{"trip_id":"d","trip_start_timestamp":"2023-01-04T12:00:00.000"}]`},
+		{url.Values{"$where": {sinceWatermark("trip_start_timestamp", "2023-01-03T00:00:00.000")}, "$offset": {"1"}, "$limit": {"5"}},
+			`[{"trip_id":"d","trip_start_timestamp":"2023-01-04T12:00:00.000"}]`},
+		{url.Values{"$where": {sinceWatermark("trip_start_timestamp", "2024-01-01T00:00:00.000")}}, `[]`},
+	}
+	for _, tt := range tests {
+		body, err := src.Fetch(TaxiTripsDataset, tt.params)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.params, err)
+		}
+		if string(body) != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.params, body, tt.want)
+		}
+	}
+
+	if _, err := src.Fetch(TaxiTripsDataset, url.Values{"$where": {"trip_id = 'a'"}}); err == nil {
+		t.Error("fetched with an unsupported $where")
+	}
+}
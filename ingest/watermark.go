@@ -0,0 +1,51 @@
+package ingest
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// loadWatermark returns the high-water mark recorded for dataset, or "" if
+// the dataset has never been loaded.
+func loadWatermark(db *sql.DB, dataset string) (string, error) {
+	var watermark string
+	err := db.QueryRow(`SELECT "watermark" FROM ingest_watermarks WHERE "dataset" = $1`, dataset).Scan(&watermark)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return watermark, err
+}
+
+// startFrom returns where an incremental load of dataset starts: c.Since if
+// it is set, otherwise the dataset's watermark.
+func (c *Collector) startFrom(dataset string) (string, error) {
+	if c.Since != "" {
+		return c.Since, nil
+	}
+	return loadWatermark(c.DB, dataset)
+}
+
+// saveWatermark records watermark for dataset. It never moves a watermark
+// backwards, and an empty watermark is ignored.
+func saveWatermark(db *sql.DB, dataset, watermark string) error {
+	if watermark == "" {
+		return nil
+	}
+	_, err := db.Exec(`INSERT INTO ingest_watermarks ("dataset", "watermark", "updated_at") values($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT ("dataset") DO UPDATE SET "watermark" = EXCLUDED."watermark", "updated_at" = CURRENT_TIMESTAMP
+		WHERE ingest_watermarks."watermark" < EXCLUDED."watermark"`, dataset, watermark)
+	return err
+}
+
+// sinceWatermark builds the SODA $where clause that selects records at or
+// after watermark. Records sharing the watermark value are fetched again
+// and deduplicated by the upsert. The watermark is a value read back from
+// the dataset or given on the command line, so a quote in it is escaped
+// as SoQL does, by doubling it.
+func sinceWatermark(field, watermark string) string {
+	if watermark == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s >= '%s'", field, strings.ReplaceAll(watermark, "'", "''"))
+}
@@ -0,0 +1,18 @@
+package ingest
+
+import "testing"
+
+func TestSinceWatermark(t *testing.T) {
+	tests := []struct {
+		watermark, want string
+	}{
+		{"", ""},
+		{"2023-01-02T13:00:00.000", "trip_start_timestamp >= '2023-01-02T13:00:00.000'"},
+		{"2023' OR '1' = '1", "trip_start_timestamp >= '2023'' OR ''1'' = ''1'"},
+	}
+	for _, tt := range tests {
+		if got := sinceWatermark("trip_start_timestamp", tt.watermark); got != tt.want {
+			t.Errorf("sinceWatermark(%q): got %q, want %q", tt.watermark, got, tt.want)
+		}
+	}
+}
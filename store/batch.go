@@ -0,0 +1,178 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// UpsertSpec describes a table loaded by a BatchLoader. Key is the natural
+// key the upsert conflicts on; every other column is overwritten.
+type UpsertSpec struct {
+	Table   string
+	Columns []string
+	Key     []string
+}
+
+// BatchLoader buffers rows and loads them a batch at a time. On Postgres
+// each batch is streamed with COPY into a temporary staging table and
+// merged into the target with INSERT ... ON CONFLICT; on SQLite it is
+// upserted with multi-row INSERTs. Either way a batch is loaded in one
+// transaction, so a failure never leaves it half loaded.
+type BatchLoader struct {
+	db     *sql.DB
+	spec   UpsertSpec
+	size   int
+	rows   [][]interface{}
+	loaded int
+}
+
+func NewBatchLoader(db *sql.DB, spec UpsertSpec, size int) *BatchLoader {
+	if size < 1 {
+		size = 1
+	}
+	return &BatchLoader{db: db, spec: spec, size: size}
+}
+
+// Add buffers a row, in spec.Columns order, and loads the batch once it is
+// full.
+func (b *BatchLoader) Add(row ...interface{}) error {
+	if len(row) != len(b.spec.Columns) {
+		return fmt.Errorf("%s: got %d values for %d columns", b.spec.Table, len(row), len(b.spec.Columns))
+	}
+	b.rows = append(b.rows, row)
+	if len(b.rows) >= b.size {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Flush loads any buffered rows.
+func (b *BatchLoader) Flush() error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+	load := b.copyBatch
+	if dialectOf(b.db) == sqliteDialect {
+		load = b.insertBatch
+	}
+	if err := inTx(b.db, load); err != nil {
+		return fmt.Errorf("%s: loading batch of %d rows: %v", b.spec.Table, len(b.rows), err)
+	}
+	b.loaded += len(b.rows)
+	b.rows = b.rows[:0]
+	return nil
+}
+
+// Loaded returns how many rows have been committed.
+func (b *BatchLoader) Loaded() int {
+	return b.loaded
+}
+
+func (b *BatchLoader) copyBatch(tx *sql.Tx) error {
+	stage := "stage_" + b.spec.Table
+
+	// The staging table has only the copied columns, and no defaults: a
+	// serial default would draw a sequence value for every staged row.
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA`,
+		pq.QuoteIdentifier(stage), strings.Join(quoteIdentifiers(b.spec.Columns), ", "), pq.QuoteIdentifier(b.spec.Table)))
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn(stage, b.spec.Columns...))
+	if err != nil {
+		return err
+	}
+	for _, row := range b.rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(b.mergeSQL(stage))
+	return err
+}
+
+// mergeSQL moves the staged rows into the target table. DISTINCT ON keeps
+// one row per key so a batch holding the same record twice still merges.
+func (b *BatchLoader) mergeSQL(stage string) string {
+	columns := quoteIdentifiers(b.spec.Columns)
+	key := quoteIdentifiers(b.spec.Key)
+
+	return fmt.Sprintf(`INSERT INTO %s (%s)
+		SELECT DISTINCT ON (%s) %s FROM %s
+		ON CONFLICT (%s) DO UPDATE SET %s`,
+		pq.QuoteIdentifier(b.spec.Table), strings.Join(columns, ", "),
+		strings.Join(key, ", "), strings.Join(columns, ", "), pq.QuoteIdentifier(stage),
+		strings.Join(key, ", "), b.updates())
+}
+
+// sqliteMaxVariables is SQLite's limit on parameters in one statement.
+const sqliteMaxVariables = 32766
+
+// insertBatch upserts the batch with as few multi-row INSERTs as SQLite's
+// parameter limit allows. SQLite applies the rows in order, so when a batch
+// holds the same record twice the later one wins.
+func (b *BatchLoader) insertBatch(tx *sql.Tx) error {
+	perStatement := sqliteMaxVariables / len(b.spec.Columns)
+	for start := 0; start < len(b.rows); start += perStatement {
+		end := start + perStatement
+		if end > len(b.rows) {
+			end = len(b.rows)
+		}
+
+		var values []string
+		var args []interface{}
+		for _, row := range b.rows[start:end] {
+			values = append(values, "("+placeholders(len(args)+1, len(row))+")")
+			args = append(args, row...)
+		}
+		if _, err := tx.Exec(b.insertSQL(values), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BatchLoader) insertSQL(values []string) string {
+	return fmt.Sprintf(`INSERT INTO %s (%s) VALUES %s
+		ON CONFLICT (%s) DO UPDATE SET %s`,
+		pq.QuoteIdentifier(b.spec.Table), strings.Join(quoteIdentifiers(b.spec.Columns), ", "),
+		strings.Join(values, ", "),
+		strings.Join(quoteIdentifiers(b.spec.Key), ", "), b.updates())
+}
+
+// updates overwrites every column but the key with the conflicting row.
+func (b *BatchLoader) updates() string {
+	isKey := map[string]bool{}
+	for _, k := range b.spec.Key {
+		isKey[k] = true
+	}
+	var updates []string
+	for _, c := range b.spec.Columns {
+		if !isKey[c] {
+			q := pq.QuoteIdentifier(c)
+			updates = append(updates, q+" = EXCLUDED."+q)
+		}
+	}
+	return strings.Join(updates, ", ")
+}
+
+func quoteIdentifiers(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = pq.QuoteIdentifier(name)
+	}
+	return quoted
+}
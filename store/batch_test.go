@@ -0,0 +1,36 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Staging a batch draws no ids, so new rows take the next ids in turn.
+func TestBatchLoaderIDs(t *testing.T) {
+	spec := UpsertSpec{
+		Table:   "transportation",
+		Columns: []string{"trip_id", "pickup_zip_code"},
+		Key:     []string{"trip_id"},
+	}
+	for name, db := range testDBs(t) {
+		if _, err := db.Exec(`DELETE FROM transportation`); err != nil {
+			t.Fatal(err)
+		}
+		for batch := 0; batch < 2; batch++ {
+			b := NewBatchLoader(db, spec, 3)
+			for i := 0; i < 3; i++ {
+				if err := b.Add(fmt.Sprintf("t%d-%d", batch, i), "60611"); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			}
+		}
+
+		var first, last, rows int64
+		if err := db.QueryRow(`SELECT MIN("id"), MAX("id"), COUNT(*) FROM transportation`).Scan(&first, &last, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if rows != 6 || last-first != 5 {
+			t.Errorf("%s: got %d rows with ids %d to %d, want 6 consecutive ids", name, rows, first, last)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package store holds the service's database: opening it, migrating its
+// schema, bulk loading rows, refreshing the summary tables and answering
+// the report queries. Postgres and SQLite are supported.
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Config holds the database settings.
+type Config struct {
+	// Driver is "postgres" (the default) or "sqlite". SQLite keeps the
+	// whole database in the file at Path and ignores the connection
+	// settings below it.
+	Driver string `json:"driver"`
+	Path   string `json:"path"`
+
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	SSLMode  string `json:"sslmode"`
+
+	// BatchSize is how many rows bulk loads commit per transaction.
+	BatchSize int `json:"batch_size"`
+}
+
+// DSN returns the connection string for the driver. For lib/pq, a host
+// starting with "/" is a Unix socket directory, such as
+// /cloudsql/<instance> on Cloud Run. SQLite waits up to five seconds for
+// another process, such as a running migration, to release the file.
+func (c Config) DSN() string {
+	if c.Driver == SQLiteDriver {
+		return c.Path + "?_pragma=busy_timeout(5000)"
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=%s",
+		quoteDSN(c.Host), c.Port, quoteDSN(c.User), quoteDSN(c.Name), quoteDSN(c.SSLMode))
+	if c.Password != "" {
+		dsn += " password=" + quoteDSN(c.Password)
+	}
+	return dsn
+}
+
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// Open opens the database described by cfg. It does not connect until the
+// database is first used.
+func Open(cfg Config) (*sql.DB, error) {
+	log.Print("Initializing the DB connection")
+
+	db, err := sql.Open(cfg.Driver, cfg.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open connection to database: %v", err)
+	}
+
+	// SQLite allows one writer at a time; a single connection queues the
+	// collectors' writes instead of failing them with SQLITE_BUSY.
+	if cfg.Driver == SQLiteDriver {
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"database/sql"
+
+	"modernc.org/sqlite"
+)
+
+// Database drivers, chosen with Config.Driver.
+const (
+	PostgresDriver = "postgres"
+	SQLiteDriver   = "sqlite"
+)
+
+// dialect holds the SQL that differs between the databases the service can
+// store its data in. Everything else is written to run on both.
+type dialect struct {
+	Name string
+
+	// Migrations is the directory of migrationFiles holding the schema.
+	Migrations string
+
+	// MigrationsTable creates schema_migrations if it does not exist.
+	MigrationsTable string
+
+	// LockMigrations and UnlockMigrations take and release a lock, keyed by
+	// $1, that serializes migrations across processes. They are empty if
+	// the database needs none.
+	LockMigrations   string
+	UnlockMigrations string
+
+	// LockSummary takes a lock, keyed by the summary table name in $1, that
+	// serializes rebuilds of the table until the transaction ends. It is
+	// empty if transactions already run one at a time.
+	LockSummary string
+
+	// Reports are the report queries SQLStore runs.
+	Reports reportQueries
+}
+
+var postgresDialect = &dialect{
+	Name:       PostgresDriver,
+	Migrations: "migrations/postgres",
+	MigrationsTable: `CREATE TABLE IF NOT EXISTS "schema_migrations" (
+		"version" INTEGER,
+		"name" VARCHAR(255) NOT NULL,
+		"applied_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY ("version")
+	);`,
+	LockMigrations:   `SELECT pg_advisory_lock($1)`,
+	UnlockMigrations: `SELECT pg_advisory_unlock($1)`,
+	LockSummary:      `SELECT pg_advisory_xact_lock(hashtext($1))`,
+	Reports:          postgresReports,
+}
+
+// SQLite has no time zones, so timestamps are kept as TIMESTAMP text the
+// driver converts, and dates as YYYY-MM-DD text. Its database belongs to a
+// single process, which writes over a single connection, so migrations and
+// summary rebuilds take no lock.
+var sqliteDialect = &dialect{
+	Name:       SQLiteDriver,
+	Migrations: "migrations/sqlite",
+	MigrationsTable: `CREATE TABLE IF NOT EXISTS "schema_migrations" (
+		"version" INTEGER,
+		"name" VARCHAR(255) NOT NULL,
+		"applied_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY ("version")
+	);`,
+	Reports: sqliteReports,
+}
+
+// dialectOf returns the dialect of the database db is connected to.
+func dialectOf(db *sql.DB) *dialect {
+	if _, ok := db.Driver().(*sqlite.Driver); ok {
+		return sqliteDialect
+	}
+	return postgresDialect
+}
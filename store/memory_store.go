@@ -0,0 +1,473 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MemoryStore is a ReportStore over tables held in memory, for testing
+// handlers and report logic without a database. Its tables mirror the
+// tables SQLStore's reports and summaries are read from, with "" standing
+// for NULL; fill them before use and do not change them while in use.
+type MemoryStore struct {
+	TripCounts     []TripCountRow
+	PermitCounts   []PermitCountRow
+	Covid          []CovidRow
+	CCVI           []CCVIRow
+	Boundaries     []BoundaryRow
+	CommunityAreas []CommunityAreaRow
+	Unemployment   []UnemploymentRow
+
+	// Refreshed maps summary table names to their as-of time.
+	Refreshed map[string]time.Time
+}
+
+// TripCountRow is a row of trip_counts. TripDate is formatted 2006-01-02.
+type TripCountRow struct {
+	PickupZipCode  string
+	DropoffZipCode string
+	TripDate       string
+	NumberOfTrips  int
+}
+
+// PermitCountRow is a row of permit_counts. IssueDate is formatted
+// 2006-01-02.
+type PermitCountRow struct {
+	CommunityArea   int
+	PermitType      string
+	IssueDate       string
+	NumberOfPermits int
+}
+
+type CovidRow struct {
+	ZipCode            string
+	Tests              int
+	PercentagePositive float64
+}
+
+type CCVIRow struct {
+	CommunityAreaOrZip int
+	GeographyType      string
+	CommunityAreaName  string
+	CcviCategory       string
+}
+
+type BoundaryRow struct {
+	CommunityArea string
+	ZipCode       string
+	Geometry      json.RawMessage
+}
+
+type CommunityAreaRow struct {
+	CommunityArea string
+	Community     string
+	Geometry      json.RawMessage
+}
+
+type UnemploymentRow struct {
+	CommunityArea     string
+	BelowPovertyLevel float64
+	PerCapitaIncome   int
+	Unemployment      float64
+}
+
+// airportNames matches the airport names AirportTrips selects in SQL.
+var airportNames = map[string]string{
+	"60666": "O'Hare",
+	"60638": "Midway",
+}
+
+func (s *MemoryStore) AirportTrips(q AirportTripsQuery) ([]AirportTripSummary, int, error) {
+	airports := stringSet(q.AirportZips)
+
+	type key struct{ pickup, period, dropoff string }
+	var keys []key
+	sums := map[key]int{}
+	for _, t := range s.TripCounts {
+		if !airports[t.PickupZipCode] || t.DropoffZipCode == "" || !q.Dates.contains(t.TripDate) {
+			continue
+		}
+		k := key{t.PickupZipCode, truncDate(t.TripDate, q.Period), t.DropoffZipCode}
+		if _, ok := sums[k]; !ok {
+			keys = append(keys, k)
+		}
+		sums[k] += t.NumberOfTrips
+	}
+
+	summaries := []AirportTripSummary{}
+	for _, k := range keys {
+		summaries = append(summaries, AirportTripSummary{
+			Airport:        airportNames[k.pickup],
+			PickupZipCode:  k.pickup,
+			PeriodStart:    k.period,
+			DropoffZipCode: k.dropoff,
+			NumberOfTrips:  sums[k],
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.PeriodStart != b.PeriodStart {
+			return a.PeriodStart < b.PeriodStart
+		}
+		if a.PickupZipCode != b.PickupZipCode {
+			return a.PickupZipCode < b.PickupZipCode
+		}
+		if a.NumberOfTrips != b.NumberOfTrips {
+			return a.NumberOfTrips > b.NumberOfTrips
+		}
+		return a.DropoffZipCode < b.DropoffZipCode
+	})
+
+	page, total := pageRows(summaries, q.Page)
+	return page.([]AirportTripSummary), total, nil
+}
+
+func (s *MemoryStore) CovidTrips(q CovidTripsQuery) ([]TripSummary, int, error) {
+	cases := map[string]float64{}
+	for _, c := range s.Covid {
+		cases[c.ZipCode] += float64(c.Tests) * c.PercentagePositive
+	}
+
+	airports := stringSet(q.AirportZips)
+	trips := map[string]int{}
+	for _, t := range s.TripCounts {
+		if airports[t.PickupZipCode] && t.DropoffZipCode != "" && q.Dates.contains(t.TripDate) {
+			trips[t.DropoffZipCode] += t.NumberOfTrips
+		}
+	}
+
+	var summaries []TripSummary
+	for zip, n := range trips {
+		if total, ok := cases[zip]; ok {
+			summaries = append(summaries, TripSummary{DropoffZipCode: zip, NumberOfTrips: n, TotalPosCases: total})
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].DropoffZipCode < summaries[j].DropoffZipCode })
+
+	page, total := pageRows(summaries, q.Page)
+	return page.([]TripSummary), total, nil
+}
+
+func (s *MemoryStore) CCVITrips(q CCVITripsQuery) ([]CCVITripSummary, int, error) {
+	// Pair each community area in the category with its zip codes, as the
+	// SQL joins ccvi to boundaries.
+	type areaZip struct {
+		area int
+		name string
+		zip  string
+	}
+	var areaZips []areaZip
+	for _, c := range s.CCVI {
+		if c.CcviCategory != q.Category {
+			continue
+		}
+		for _, b := range s.Boundaries {
+			if strconv.Itoa(c.CommunityAreaOrZip) == b.CommunityArea {
+				areaZips = append(areaZips, areaZip{c.CommunityAreaOrZip, c.CommunityAreaName, b.ZipCode})
+			}
+		}
+	}
+
+	type areaKey struct {
+		area int
+		name string
+	}
+	to, from := map[areaKey]int{}, map[areaKey]int{}
+	for _, az := range areaZips {
+		k := areaKey{az.area, az.name}
+		for _, t := range s.TripCounts {
+			if !q.Dates.contains(t.TripDate) {
+				continue
+			}
+			if t.PickupZipCode == az.zip {
+				to[k] += t.NumberOfTrips
+			}
+			if t.DropoffZipCode == az.zip {
+				from[k] += t.NumberOfTrips
+			}
+		}
+	}
+
+	var summaries []CCVITripSummary
+	for kt, nt := range to {
+		for kf, nf := range from {
+			if kt.area == kf.area {
+				summaries = append(summaries, CCVITripSummary{
+					NeighborhoodZipCode: strconv.Itoa(kt.area),
+					CommunityAreaName:   kt.name,
+					NumberOfTripsTo:     nt,
+					NumberOfTripsFrom:   nf,
+				})
+			}
+		}
+	}
+	// Community areas are numbers, and sort as numbers, as in SQL.
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.NeighborhoodZipCode != b.NeighborhoodZipCode {
+			x, _ := strconv.Atoi(a.NeighborhoodZipCode)
+			y, _ := strconv.Atoi(b.NeighborhoodZipCode)
+			return x < y
+		}
+		if a.CommunityAreaName != b.CommunityAreaName {
+			return a.CommunityAreaName < b.CommunityAreaName
+		}
+		if a.NumberOfTripsTo != b.NumberOfTripsTo {
+			return a.NumberOfTripsTo < b.NumberOfTripsTo
+		}
+		return a.NumberOfTripsFrom < b.NumberOfTripsFrom
+	})
+
+	page, total := pageRows(summaries, q.Page)
+	return page.([]CCVITripSummary), total, nil
+}
+
+func (s *MemoryStore) TripPeriods(q TripPeriodsQuery) ([]TripPeriodCount, error) {
+	type key struct{ direction, zip, period string }
+	var keys []key
+	sums := map[key]int{}
+	add := func(direction, zip string, t TripCountRow) {
+		if zip == "" || (q.ZipCode.Valid && zip != q.ZipCode.String) || !q.Dates.contains(t.TripDate) {
+			return
+		}
+		k := key{direction, zip, truncDate(t.TripDate, q.Period)}
+		if _, ok := sums[k]; !ok {
+			keys = append(keys, k)
+		}
+		sums[k] += t.NumberOfTrips
+	}
+	for _, t := range s.TripCounts {
+		add("pickup", t.PickupZipCode, t)
+		add("dropoff", t.DropoffZipCode, t)
+	}
+
+	var counts []TripPeriodCount
+	for _, k := range keys {
+		counts = append(counts, TripPeriodCount{Direction: k.direction, ZipCode: k.zip, PeriodStart: k.period, NumberOfTrips: sums[k]})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.ZipCode != b.ZipCode {
+			return a.ZipCode < b.ZipCode
+		}
+		if a.Direction != b.Direction {
+			return a.Direction > b.Direction
+		}
+		return a.PeriodStart < b.PeriodStart
+	})
+	return counts, nil
+}
+
+func (s *MemoryStore) UnemployedAreas(q UnemploymentQuery) ([]UnemployNeighborhoodSummary, int, error) {
+	var summaries []UnemployNeighborhoodSummary
+	for _, u := range s.Unemployment {
+		for _, p := range s.PermitCounts {
+			if strconv.Itoa(p.CommunityArea) == u.CommunityArea && q.Dates.contains(p.IssueDate) {
+				summaries = append(summaries, UnemployNeighborhoodSummary{
+					CommunityArea:     u.CommunityArea,
+					Unemployment:      u.Unemployment,
+					BelowPovertyLevel: u.BelowPovertyLevel,
+				})
+				break
+			}
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Unemployment != b.Unemployment {
+			return a.Unemployment > b.Unemployment
+		}
+		if a.BelowPovertyLevel != b.BelowPovertyLevel {
+			return a.BelowPovertyLevel > b.BelowPovertyLevel
+		}
+		return a.CommunityArea < b.CommunityArea
+	})
+	if len(summaries) > q.Limit {
+		summaries = summaries[:q.Limit]
+	}
+
+	page, total := pageRows(summaries, q.Page)
+	return page.([]UnemployNeighborhoodSummary), total, nil
+}
+
+func (s *MemoryStore) PermitAreas(q PermitQuery) ([]LoanNeighborhoodSummary, int, error) {
+	type key struct {
+		area   string
+		income int
+	}
+	var keys []key
+	counts := map[key]int{}
+	for _, u := range s.Unemployment {
+		if u.PerCapitaIncome >= q.IncomeBelow {
+			continue
+		}
+		for _, p := range s.PermitCounts {
+			if strconv.Itoa(p.CommunityArea) != u.CommunityArea || p.PermitType != q.PermitType || !q.Dates.contains(p.IssueDate) {
+				continue
+			}
+			k := key{u.CommunityArea, u.PerCapitaIncome}
+			if _, ok := counts[k]; !ok {
+				keys = append(keys, k)
+			}
+			counts[k] += p.NumberOfPermits
+		}
+	}
+
+	var summaries []LoanNeighborhoodSummary
+	for _, k := range keys {
+		summaries = append(summaries, LoanNeighborhoodSummary{CommunityArea: k.area, PermitCount: counts[k], PerCapitaIncome: k.income})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.PermitCount != b.PermitCount {
+			return a.PermitCount < b.PermitCount
+		}
+		return a.CommunityArea < b.CommunityArea
+	})
+	if len(summaries) > q.Limit {
+		summaries = summaries[:q.Limit]
+	}
+
+	page, total := pageRows(summaries, q.Page)
+	return page.([]LoanNeighborhoodSummary), total, nil
+}
+
+func (s *MemoryStore) Geometries(kind string, keys []string) (map[string]json.RawMessage, error) {
+	want := stringSet(keys)
+	geometries := map[string]json.RawMessage{}
+	put := func(key string, geom json.RawMessage) {
+		if _, ok := geometries[key]; !ok && want[key] && GeometryText(geom).Valid {
+			geometries[key] = geom
+		}
+	}
+	switch kind {
+	case ZipCodeArea:
+		for _, b := range s.Boundaries {
+			put(b.ZipCode, b.Geometry)
+		}
+	case CommunityArea:
+		for _, a := range s.CommunityAreas {
+			put(a.CommunityArea, a.Geometry)
+		}
+	}
+	return geometries, nil
+}
+
+func (s *MemoryStore) AsOf(summary string) (*time.Time, error) {
+	asOf, ok := s.Refreshed[summary]
+	if !ok {
+		return nil, nil
+	}
+	return &asOf, nil
+}
+
+func stringSet(list []string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range list {
+		set[v] = true
+	}
+	return set
+}
+
+// truncDate returns the start of the day, week (from Monday) or month that
+// date falls in, as date_trunc does.
+func truncDate(date, period string) string {
+	t, err := time.Parse(DateLayout, date)
+	if err != nil {
+		return date
+	}
+	switch period {
+	case "week":
+		t = t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	case "month":
+		t = t.AddDate(0, 0, 1-t.Day())
+	}
+	return t.Format(DateLayout)
+}
+
+// pageRows sorts and pages rows, a slice of report structs in their
+// natural order, in memory as queryPage does in SQL: rows that tie on the
+// sort field keep their natural order. It returns the page, as a slice of
+// the same type, and the number of rows before paging.
+func pageRows(rows interface{}, page Page) (interface{}, int) {
+	v := reflect.ValueOf(rows)
+	total := v.Len()
+
+	sorted := reflect.MakeSlice(v.Type(), total, total)
+	reflect.Copy(sorted, v)
+	if page.Sort != "" {
+		field := jsonField(v.Type().Elem(), page.Sort)
+		numeric := numericFields[page.Sort]
+		sort.SliceStable(sorted.Interface(), func(i, j int) bool {
+			a, b := sorted.Index(i), sorted.Index(j)
+			c := compareValues(a.Field(field), b.Field(field), numeric)
+			return c != 0 && (c < 0) != page.Desc
+		})
+	}
+
+	if page.Size > 0 {
+		start := (page.Number - 1) * page.Size
+		if start > total {
+			start = total
+		}
+		end := start + page.Size
+		if end > total {
+			end = total
+		}
+		sorted = sorted.Slice(start, end)
+	}
+	return sorted.Interface(), total
+}
+
+// jsonField returns the index of the field of struct type t whose json
+// name is name.
+func jsonField(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == name {
+			return i
+		}
+	}
+	return 0
+}
+
+// numericFields are the report fields held as strings that SQL selects as
+// numbers, and so sorts as numbers.
+var numericFields = map[string]bool{"neighborhood_zip_code": true}
+
+// compareValues compares two values of a report field. numeric compares
+// strings as the integers they hold.
+func compareValues(a, b reflect.Value, numeric bool) int {
+	if numeric && a.Kind() == reflect.String {
+		x, _ := strconv.Atoi(a.String())
+		y, _ := strconv.Atoi(b.String())
+		return compareValues(reflect.ValueOf(x), reflect.ValueOf(y), false)
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int64:
+		switch {
+		case a.Int() < b.Int():
+			return -1
+		case a.Int() > b.Int():
+			return 1
+		}
+	case reflect.Float64:
+		switch {
+		case a.Float() < b.Float():
+			return -1
+		case a.Float() > b.Float():
+			return 1
+		}
+	case reflect.String:
+		switch {
+		case a.String() < b.String():
+			return -1
+		case a.String() > b.String():
+			return 1
+		}
+	}
+	return 0
+}
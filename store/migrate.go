@@ -0,0 +1,250 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migrations live in migrations/<dialect>/ as <version>_<name>.up.sql and
+// <version>_<name>.down.sql pairs. Versions are applied in ascending order
+// and recorded in schema_migrations. Each dialect has its own copy of every
+// version, written for that database.
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey keys the lock held while migrating, so that instances
+// starting together apply each migration once.
+const migrationLockKey = 432000005
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one schema version, with the SQL that applies and reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a Migration and when it was applied, or nil if it is
+// pending.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// loadMigrations returns the embedded migrations for d sorted by version.
+func loadMigrations(d *dialect) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, d.Migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := migrationName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migrations: unexpected file %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(migrationFiles, d.Migrations+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrations: version %d has two names, %s and %s", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	var migrations []Migration
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migrations: version %d has no up migration", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func ensureMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(dialectOf(db).MigrationsTable)
+	return err
+}
+
+// MigrationStatus lists every known migration with the time it was applied,
+// or a nil AppliedAt if it is pending.
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	migrations, err := loadMigrations(dialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT "version", "applied_at" FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, mig := range migrations {
+		states[i].Migration = mig
+		if at, ok := applied[mig.Version]; ok {
+			states[i].AppliedAt = &at
+		}
+	}
+	return states, nil
+}
+
+// withMigrationLock runs fn holding the migration lock of db's dialect. The
+// lock is held by a connection of its own, which fn does not use.
+func withMigrationLock(db *sql.DB, fn func() error) error {
+	d := dialectOf(db)
+	if d.LockMigrations == "" {
+		return fn()
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, d.LockMigrations, migrationLockKey); err != nil {
+		return fmt.Errorf("migrations: taking lock: %v", err)
+	}
+	defer conn.ExecContext(ctx, d.UnlockMigrations, migrationLockKey)
+
+	return fn()
+}
+
+// MigrateUp applies every pending migration in order and returns the ones
+// it applied. Each migration runs in its own transaction, and processes
+// migrating the same database at once take turns.
+func MigrateUp(db *sql.DB) ([]Migration, error) {
+	var applied []Migration
+	err := withMigrationLock(db, func() error {
+		var err error
+		applied, err = migrateUp(db)
+		return err
+	})
+	return applied, err
+}
+
+func migrateUp(db *sql.DB) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, state := range states {
+		if state.AppliedAt != nil {
+			continue
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(state.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations ("version", "name") values($1, $2)`, state.Version, state.Name)
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %v", state.Version, state.Name, err)
+		}
+		applied = append(applied, state.Migration)
+	}
+	return applied, nil
+}
+
+// MigrateDown rolls back the latest steps applied migrations and returns
+// the ones it rolled back.
+func MigrateDown(db *sql.DB, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := withMigrationLock(db, func() error {
+		var err error
+		reverted, err = migrateDown(db, steps)
+		return err
+	})
+	return reverted, err
+}
+
+func migrateDown(db *sql.DB, steps int) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(states) - 1; i >= 0 && len(reverted) < steps; i-- {
+		state := states[i]
+		if state.AppliedAt == nil {
+			continue
+		}
+		if state.Down == "" {
+			return reverted, fmt.Errorf("migration %04d_%s has no down migration", state.Version, state.Name)
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(state.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE "version" = $1`, state.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("migration %04d_%s: %v", state.Version, state.Name, err)
+		}
+		reverted = append(reverted, state.Migration)
+	}
+	return reverted, nil
+}
+
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
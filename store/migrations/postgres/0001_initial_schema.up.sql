@@ -0,0 +1,71 @@
+-- Data lake tables loaded by the collectors, the unique indexes their
+-- upserts conflict on, and the per-dataset high-water marks.
+
+CREATE TABLE IF NOT EXISTS "boundaries" (
+	"ID" SERIAL,
+	"community_area" VARCHAR(255),
+	"zip_code" VARCHAR(255),
+	PRIMARY KEY ("ID")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS boundaries_community_area_zip_code_key ON boundaries ("community_area", "zip_code");
+
+CREATE TABLE IF NOT EXISTS "transportation" (
+	"id" SERIAL,
+	"trip_id" VARCHAR(255) UNIQUE,
+	"trip_start_timestamp" TIMESTAMP WITH TIME ZONE,
+	"trip_end_timestamp" TIMESTAMP WITH TIME ZONE,
+	"pickup_centroid_latitude" DOUBLE PRECISION,
+	"pickup_centroid_longitude" DOUBLE PRECISION,
+	"dropoff_centroid_latitude" DOUBLE PRECISION,
+	"dropoff_centroid_longitude" DOUBLE PRECISION,
+	"pickup_zip_code" VARCHAR(255),
+	"dropoff_zip_code" VARCHAR(255),
+	PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "unemployment" (
+	"id" SERIAL,
+	"community_area" VARCHAR(255),
+	"below_poverty_level" DOUBLE PRECISION,
+	"per_capita_income" INTEGER,
+	"unemployment" DOUBLE PRECISION,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS unemployment_community_area_key ON unemployment ("community_area");
+
+CREATE TABLE IF NOT EXISTS "permit" (
+	"serial_id" SERIAL,
+	"id" VARCHAR(255),
+	"permit_type" VARCHAR(255),
+	"community_area" INTEGER,
+	"zip_code" VARCHAR(255),
+	PRIMARY KEY ("serial_id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS permit_id_key ON permit ("id");
+
+CREATE TABLE IF NOT EXISTS "covid" (
+	"id" SERIAL,
+	"zip_code" VARCHAR(255),
+	"week_number" INTEGER,
+	"tests" INTEGER,
+	"percentage_positive" FLOAT,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS covid_zip_code_week_number_key ON covid ("zip_code", "week_number");
+
+CREATE TABLE IF NOT EXISTS "ccvi" (
+	"ID" SERIAL,
+	"community_area_or_zip" INTEGER,
+	"geography_type" VARCHAR(255),
+	"community_area_name" VARCHAR(255),
+	"ccvi_category" VARCHAR(255),
+	PRIMARY KEY ("ID")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS ccvi_community_area_or_zip_geography_type_key ON ccvi ("community_area_or_zip", "geography_type");
+
+CREATE TABLE IF NOT EXISTS "ingest_watermarks" (
+	"dataset" VARCHAR(255),
+	"watermark" VARCHAR(255) NOT NULL,
+	"updated_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	PRIMARY KEY ("dataset")
+);
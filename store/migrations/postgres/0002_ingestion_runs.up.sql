@@ -0,0 +1,14 @@
+-- One row per collector run, read by the /status endpoint.
+
+CREATE TABLE IF NOT EXISTS "ingestion_runs" (
+	"id" SERIAL,
+	"dataset" VARCHAR(255) NOT NULL,
+	"started_at" TIMESTAMP WITH TIME ZONE NOT NULL,
+	"finished_at" TIMESTAMP WITH TIME ZONE,
+	"records_fetched" INTEGER NOT NULL DEFAULT 0,
+	"records_inserted" INTEGER NOT NULL DEFAULT 0,
+	"records_skipped" JSONB NOT NULL DEFAULT '{}',
+	"error" TEXT,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS ingestion_runs_dataset_started_at_idx ON ingestion_runs ("dataset", "started_at");
@@ -0,0 +1,2 @@
+ALTER TABLE "permit" DROP COLUMN IF EXISTS "longitude";
+ALTER TABLE "permit" DROP COLUMN IF EXISTS "latitude";
@@ -0,0 +1,5 @@
+-- Permits keep their coordinates so zip codes that failed to resolve can be
+-- retried without reloading the dataset.
+
+ALTER TABLE "permit" ADD COLUMN IF NOT EXISTS "latitude" DOUBLE PRECISION;
+ALTER TABLE "permit" ADD COLUMN IF NOT EXISTS "longitude" DOUBLE PRECISION;
@@ -0,0 +1 @@
+ALTER TABLE "permit" DROP COLUMN IF EXISTS "issue_date";
@@ -0,0 +1,3 @@
+DELETE FROM report_refreshes WHERE "summary" IN ('covid_cases', 'ccvi_zip_codes', 'unemployment');
+DROP TABLE IF EXISTS "ccvi_zip_codes";
+DROP TABLE IF EXISTS "covid_cases";
@@ -0,0 +1,33 @@
+-- Summaries for the rest of the report data: covid_cases totals positive
+-- cases per zip code for req2, and ccvi_zip_codes pairs each CCVI
+-- community area with its zip codes for req3. Unemployment rates are read
+-- as loaded, so they have no table here, only a refresh time.
+
+CREATE TABLE IF NOT EXISTS "covid_cases" (
+	"zip_code" VARCHAR(255),
+	"total_pos_cases" DOUBLE PRECISION,
+	PRIMARY KEY ("zip_code")
+);
+
+CREATE TABLE IF NOT EXISTS "ccvi_zip_codes" (
+	"community_area_or_zip" INTEGER,
+	"community_area_name" VARCHAR(255),
+	"ccvi_category" VARCHAR(255),
+	"zip_code" VARCHAR(255)
+);
+CREATE INDEX IF NOT EXISTS ccvi_zip_codes_category_idx ON ccvi_zip_codes ("ccvi_category");
+
+INSERT INTO covid_cases ("zip_code", "total_pos_cases")
+	SELECT "zip_code", SUM("tests" * "percentage_positive")
+	FROM covid
+	WHERE "zip_code" IS NOT NULL
+	GROUP BY 1;
+
+INSERT INTO ccvi_zip_codes ("community_area_or_zip", "community_area_name", "ccvi_category", "zip_code")
+	SELECT ccvi."community_area_or_zip", ccvi."community_area_name", ccvi."ccvi_category", boundaries."zip_code"
+	FROM ccvi
+	JOIN boundaries
+	ON ccvi."community_area_or_zip"::TEXT = boundaries."community_area";
+
+INSERT INTO report_refreshes ("summary", "refreshed_at") VALUES ('covid_cases', now()), ('ccvi_zip_codes', now()), ('unemployment', now())
+	ON CONFLICT ("summary") DO NOTHING;
@@ -0,0 +1,4 @@
+ALTER TABLE "ccvi_zip_codes" DROP CONSTRAINT IF EXISTS "ccvi_zip_codes_pkey";
+ALTER TABLE "ccvi_zip_codes" ALTER COLUMN "community_area_or_zip" DROP NOT NULL;
+ALTER TABLE "ccvi_zip_codes" ALTER COLUMN "zip_code" DROP NOT NULL;
+DROP INDEX IF EXISTS trip_counts_key;
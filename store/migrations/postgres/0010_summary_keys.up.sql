@@ -0,0 +1,21 @@
+-- Keys for the summary tables two jobs rebuild, so that a row copied by
+-- overlapping rebuilds fails the second one instead of doubling a count.
+-- trip_counts keeps NULL for an unresolved zip code, which a primary key
+-- cannot hold, so its key is a unique index that counts NULL as a value.
+-- Both tables are rebuilt first to drop any copies already made.
+
+DELETE FROM trip_counts;
+INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips")
+	SELECT "pickup_zip_code", "dropoff_zip_code", ("trip_start_timestamp" AT TIME ZONE 'America/Chicago')::DATE, COUNT(*)
+	FROM transportation
+	WHERE "trip_start_timestamp" IS NOT NULL
+	GROUP BY 1, 2, 3;
+CREATE UNIQUE INDEX IF NOT EXISTS trip_counts_key ON trip_counts (COALESCE("pickup_zip_code", ''), COALESCE("dropoff_zip_code", ''), "trip_date");
+
+DELETE FROM ccvi_zip_codes;
+INSERT INTO ccvi_zip_codes ("community_area_or_zip", "community_area_name", "ccvi_category", "zip_code")
+	SELECT ccvi."community_area_or_zip", ccvi."community_area_name", ccvi."ccvi_category", boundaries."zip_code"
+	FROM ccvi
+	JOIN boundaries
+	ON ccvi."community_area_or_zip"::TEXT = boundaries."community_area";
+ALTER TABLE "ccvi_zip_codes" ADD PRIMARY KEY ("community_area_or_zip", "zip_code");
@@ -0,0 +1,10 @@
+ALTER TABLE "transportation"
+	ALTER COLUMN "trip_start_timestamp" TYPE TIMESTAMP WITH TIME ZONE USING "trip_start_timestamp" AT TIME ZONE current_setting('TimeZone'),
+	ALTER COLUMN "trip_end_timestamp" TYPE TIMESTAMP WITH TIME ZONE USING "trip_end_timestamp" AT TIME ZONE current_setting('TimeZone');
+
+DELETE FROM trip_counts;
+INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips")
+	SELECT "pickup_zip_code", "dropoff_zip_code", ("trip_start_timestamp" AT TIME ZONE 'America/Chicago')::DATE, COUNT(*)
+	FROM transportation
+	WHERE "trip_start_timestamp" IS NOT NULL
+	GROUP BY 1, 2, 3;
@@ -0,0 +1,17 @@
+-- SODA trip timestamps are Chicago local time without an offset. Stored as
+-- TIMESTAMP WITH TIME ZONE they were read in the session time zone, so
+-- converting them to Chicago time for trip_counts moved trips starting
+-- before 05:00 or 06:00 to the day before. They are kept as local time
+-- instead, as SQLite keeps them, reading back the wall clock each was
+-- stored with.
+
+ALTER TABLE "transportation"
+	ALTER COLUMN "trip_start_timestamp" TYPE TIMESTAMP WITHOUT TIME ZONE USING "trip_start_timestamp" AT TIME ZONE current_setting('TimeZone'),
+	ALTER COLUMN "trip_end_timestamp" TYPE TIMESTAMP WITHOUT TIME ZONE USING "trip_end_timestamp" AT TIME ZONE current_setting('TimeZone');
+
+DELETE FROM trip_counts;
+INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips")
+	SELECT "pickup_zip_code", "dropoff_zip_code", "trip_start_timestamp"::DATE, COUNT(*)
+	FROM transportation
+	WHERE "trip_start_timestamp" IS NOT NULL
+	GROUP BY 1, 2, 3;
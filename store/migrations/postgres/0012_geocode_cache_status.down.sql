@@ -0,0 +1,4 @@
+DELETE FROM geocode_cache WHERE "zip_code" IS NULL;
+ALTER TABLE "geocode_cache"
+	DROP COLUMN "resolution_status",
+	ALTER COLUMN "zip_code" SET NOT NULL;
@@ -0,0 +1,8 @@
+-- Final negative answers are cached too, so a coordinate the geocoder
+-- found nothing at, or an address without a postal code, is not paid for
+-- again. Such rows keep a null zip code and record why in
+-- resolution_status, with the same values as transportation and permit.
+
+ALTER TABLE "geocode_cache"
+	ALTER COLUMN "zip_code" DROP NOT NULL,
+	ADD COLUMN "resolution_status" VARCHAR(32) NOT NULL DEFAULT 'resolved';
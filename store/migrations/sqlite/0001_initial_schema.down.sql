@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS "ingest_watermarks";
+DROP TABLE IF EXISTS "ccvi";
+DROP TABLE IF EXISTS "covid";
+DROP TABLE IF EXISTS "permit";
+DROP TABLE IF EXISTS "unemployment";
+DROP TABLE IF EXISTS "transportation";
+DROP TABLE IF EXISTS "boundaries";
@@ -0,0 +1,66 @@
+-- Data lake tables loaded by the collectors, the unique indexes their
+-- upserts conflict on, and the per-dataset high-water marks. Timestamps
+-- from SODA are kept as the text the API sends, in Chicago time.
+
+CREATE TABLE IF NOT EXISTS "boundaries" (
+	"ID" INTEGER PRIMARY KEY,
+	"community_area" VARCHAR(255),
+	"zip_code" VARCHAR(255)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS boundaries_community_area_zip_code_key ON boundaries ("community_area", "zip_code");
+
+CREATE TABLE IF NOT EXISTS "transportation" (
+	"id" INTEGER PRIMARY KEY,
+	"trip_id" VARCHAR(255) UNIQUE,
+	"trip_start_timestamp" TEXT,
+	"trip_end_timestamp" TEXT,
+	"pickup_centroid_latitude" DOUBLE PRECISION,
+	"pickup_centroid_longitude" DOUBLE PRECISION,
+	"dropoff_centroid_latitude" DOUBLE PRECISION,
+	"dropoff_centroid_longitude" DOUBLE PRECISION,
+	"pickup_zip_code" VARCHAR(255),
+	"dropoff_zip_code" VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS "unemployment" (
+	"id" INTEGER PRIMARY KEY,
+	"community_area" VARCHAR(255),
+	"below_poverty_level" DOUBLE PRECISION,
+	"per_capita_income" INTEGER,
+	"unemployment" DOUBLE PRECISION
+);
+CREATE UNIQUE INDEX IF NOT EXISTS unemployment_community_area_key ON unemployment ("community_area");
+
+CREATE TABLE IF NOT EXISTS "permit" (
+	"serial_id" INTEGER PRIMARY KEY,
+	"id" VARCHAR(255),
+	"permit_type" VARCHAR(255),
+	"community_area" INTEGER,
+	"zip_code" VARCHAR(255)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS permit_id_key ON permit ("id");
+
+CREATE TABLE IF NOT EXISTS "covid" (
+	"id" INTEGER PRIMARY KEY,
+	"zip_code" VARCHAR(255),
+	"week_number" INTEGER,
+	"tests" INTEGER,
+	"percentage_positive" FLOAT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS covid_zip_code_week_number_key ON covid ("zip_code", "week_number");
+
+CREATE TABLE IF NOT EXISTS "ccvi" (
+	"ID" INTEGER PRIMARY KEY,
+	"community_area_or_zip" INTEGER,
+	"geography_type" VARCHAR(255),
+	"community_area_name" VARCHAR(255),
+	"ccvi_category" VARCHAR(255)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS ccvi_community_area_or_zip_geography_type_key ON ccvi ("community_area_or_zip", "geography_type");
+
+CREATE TABLE IF NOT EXISTS "ingest_watermarks" (
+	"dataset" VARCHAR(255),
+	"watermark" VARCHAR(255) NOT NULL,
+	"updated_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY ("dataset")
+);
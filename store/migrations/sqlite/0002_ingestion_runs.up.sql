@@ -0,0 +1,13 @@
+-- One row per collector run, read by the /status endpoint.
+
+CREATE TABLE IF NOT EXISTS "ingestion_runs" (
+	"id" INTEGER PRIMARY KEY,
+	"dataset" VARCHAR(255) NOT NULL,
+	"started_at" TIMESTAMP NOT NULL,
+	"finished_at" TIMESTAMP,
+	"records_fetched" INTEGER NOT NULL DEFAULT 0,
+	"records_inserted" INTEGER NOT NULL DEFAULT 0,
+	"records_skipped" TEXT NOT NULL DEFAULT '{}',
+	"error" TEXT
+);
+CREATE INDEX IF NOT EXISTS ingestion_runs_dataset_started_at_idx ON ingestion_runs ("dataset", "started_at");
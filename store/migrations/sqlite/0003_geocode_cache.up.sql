@@ -0,0 +1,10 @@
+-- Reverse geocoding results keyed by coordinates rounded to the configured
+-- precision, so repeated trip centroids are only geocoded once.
+
+CREATE TABLE IF NOT EXISTS "geocode_cache" (
+	"lat_key" VARCHAR(32),
+	"lon_key" VARCHAR(32),
+	"zip_code" VARCHAR(255) NOT NULL,
+	"resolved_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY ("lat_key", "lon_key")
+);
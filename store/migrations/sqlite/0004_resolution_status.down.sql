@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS permit_unresolved_idx;
+ALTER TABLE "permit" DROP COLUMN "resolution_status";
+
+DROP INDEX IF EXISTS transportation_unresolved_idx;
+ALTER TABLE "transportation" DROP COLUMN "resolution_status";
@@ -0,0 +1,9 @@
+-- Trips and permits whose coordinates could not be reverse geocoded are
+-- stored with null zip codes; resolution_status records why, and the
+-- partial indexes find them again for re-resolution.
+
+ALTER TABLE "transportation" ADD COLUMN "resolution_status" VARCHAR(32) NOT NULL DEFAULT 'resolved';
+CREATE INDEX IF NOT EXISTS transportation_unresolved_idx ON transportation ("resolution_status") WHERE "resolution_status" <> 'resolved';
+
+ALTER TABLE "permit" ADD COLUMN "resolution_status" VARCHAR(32) NOT NULL DEFAULT 'resolved';
+CREATE INDEX IF NOT EXISTS permit_unresolved_idx ON permit ("resolution_status") WHERE "resolution_status" <> 'resolved';
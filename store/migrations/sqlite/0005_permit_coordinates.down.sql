@@ -0,0 +1,2 @@
+ALTER TABLE "permit" DROP COLUMN "longitude";
+ALTER TABLE "permit" DROP COLUMN "latitude";
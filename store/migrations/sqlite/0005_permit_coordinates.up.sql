@@ -0,0 +1,5 @@
+-- Permits keep their coordinates so zip codes that failed to resolve can be
+-- retried without reloading the dataset.
+
+ALTER TABLE "permit" ADD COLUMN "latitude" DOUBLE PRECISION;
+ALTER TABLE "permit" ADD COLUMN "longitude" DOUBLE PRECISION;
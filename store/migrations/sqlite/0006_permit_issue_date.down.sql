@@ -0,0 +1 @@
+ALTER TABLE "permit" DROP COLUMN "issue_date";
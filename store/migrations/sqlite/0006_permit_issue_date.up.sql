@@ -0,0 +1,3 @@
+-- Permits keep their issue date so reports can be limited to a date range.
+
+ALTER TABLE "permit" ADD COLUMN "issue_date" TEXT;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "community_areas";
+ALTER TABLE "boundaries" DROP COLUMN "the_geom";
@@ -0,0 +1,11 @@
+-- Zip code and community area outlines, stored as GeoJSON geometry text, so
+-- reports can be exported as GeoJSON.
+
+ALTER TABLE "boundaries" ADD COLUMN "the_geom" TEXT;
+
+CREATE TABLE IF NOT EXISTS "community_areas" (
+	"community_area" VARCHAR(255),
+	"community" VARCHAR(255),
+	"the_geom" TEXT,
+	PRIMARY KEY ("community_area")
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "report_refreshes";
+DROP TABLE IF EXISTS "permit_counts";
+DROP TABLE IF EXISTS "trip_counts";
@@ -0,0 +1,41 @@
+-- Summary tables the reports read instead of the raw trips and permits.
+-- They are rebuilt after the collectors that feed them finish; see
+-- summary.go. report_refreshes records when each was last rebuilt. Dates
+-- are stored as YYYY-MM-DD text.
+
+CREATE TABLE IF NOT EXISTS "trip_counts" (
+	"pickup_zip_code" VARCHAR(255),
+	"dropoff_zip_code" VARCHAR(255),
+	"trip_date" TEXT NOT NULL,
+	"number_of_trips" INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS trip_counts_pickup_idx ON trip_counts ("pickup_zip_code", "trip_date");
+CREATE INDEX IF NOT EXISTS trip_counts_dropoff_idx ON trip_counts ("dropoff_zip_code", "trip_date");
+
+CREATE TABLE IF NOT EXISTS "permit_counts" (
+	"community_area" INTEGER,
+	"permit_type" VARCHAR(255),
+	"issue_date" TEXT,
+	"number_of_permits" INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS permit_counts_community_area_idx ON permit_counts ("community_area");
+
+CREATE TABLE IF NOT EXISTS "report_refreshes" (
+	"summary" VARCHAR(255),
+	"refreshed_at" TIMESTAMP NOT NULL,
+	PRIMARY KEY ("summary")
+);
+
+INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips")
+	SELECT "pickup_zip_code", "dropoff_zip_code", date("trip_start_timestamp"), COUNT(*)
+	FROM transportation
+	WHERE "trip_start_timestamp" IS NOT NULL
+	GROUP BY 1, 2, 3;
+
+INSERT INTO permit_counts ("community_area", "permit_type", "issue_date", "number_of_permits")
+	SELECT "community_area", "permit_type", date("issue_date"), COUNT(*)
+	FROM permit
+	GROUP BY 1, 2, 3;
+
+INSERT INTO report_refreshes ("summary", "refreshed_at") VALUES ('trip_counts', CURRENT_TIMESTAMP), ('permit_counts', CURRENT_TIMESTAMP)
+	ON CONFLICT ("summary") DO NOTHING;
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS "ccvi_zip_codes";
+CREATE TABLE "ccvi_zip_codes" (
+	"community_area_or_zip" INTEGER,
+	"community_area_name" VARCHAR(255),
+	"ccvi_category" VARCHAR(255),
+	"zip_code" VARCHAR(255)
+);
+CREATE INDEX IF NOT EXISTS ccvi_zip_codes_category_idx ON ccvi_zip_codes ("ccvi_category");
+INSERT INTO ccvi_zip_codes ("community_area_or_zip", "community_area_name", "ccvi_category", "zip_code")
+	SELECT ccvi."community_area_or_zip", ccvi."community_area_name", ccvi."ccvi_category", boundaries."zip_code"
+	FROM ccvi
+	JOIN boundaries
+	ON CAST(ccvi."community_area_or_zip" AS TEXT) = boundaries."community_area";
+DROP INDEX IF EXISTS trip_counts_key;
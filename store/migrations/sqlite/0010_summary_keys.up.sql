@@ -0,0 +1,29 @@
+-- Keys for the summary tables two jobs rebuild, so that a row copied by
+-- overlapping rebuilds fails the second one instead of doubling a count.
+-- trip_counts keeps NULL for an unresolved zip code, which a primary key
+-- cannot hold, so its key is a unique index that counts NULL as a value.
+-- SQLite cannot add a primary key to a table, so ccvi_zip_codes is
+-- recreated; both tables are rebuilt to drop any copies already made.
+
+DELETE FROM trip_counts;
+INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips")
+	SELECT "pickup_zip_code", "dropoff_zip_code", date("trip_start_timestamp"), COUNT(*)
+	FROM transportation
+	WHERE "trip_start_timestamp" IS NOT NULL
+	GROUP BY 1, 2, 3;
+CREATE UNIQUE INDEX IF NOT EXISTS trip_counts_key ON trip_counts (COALESCE("pickup_zip_code", ''), COALESCE("dropoff_zip_code", ''), "trip_date");
+
+DROP TABLE IF EXISTS "ccvi_zip_codes";
+CREATE TABLE "ccvi_zip_codes" (
+	"community_area_or_zip" INTEGER,
+	"community_area_name" VARCHAR(255),
+	"ccvi_category" VARCHAR(255),
+	"zip_code" VARCHAR(255),
+	PRIMARY KEY ("community_area_or_zip", "zip_code")
+);
+CREATE INDEX IF NOT EXISTS ccvi_zip_codes_category_idx ON ccvi_zip_codes ("ccvi_category");
+INSERT INTO ccvi_zip_codes ("community_area_or_zip", "community_area_name", "ccvi_category", "zip_code")
+	SELECT ccvi."community_area_or_zip", ccvi."community_area_name", ccvi."ccvi_category", boundaries."zip_code"
+	FROM ccvi
+	JOIN boundaries
+	ON CAST(ccvi."community_area_or_zip" AS TEXT) = boundaries."community_area";
@@ -0,0 +1,11 @@
+ALTER TABLE "geocode_cache" RENAME TO "geocode_cache_new";
+CREATE TABLE "geocode_cache" (
+	"lat_key" VARCHAR(32),
+	"lon_key" VARCHAR(32),
+	"zip_code" VARCHAR(255) NOT NULL,
+	"resolved_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY ("lat_key", "lon_key")
+);
+INSERT INTO geocode_cache ("lat_key", "lon_key", "zip_code", "resolved_at")
+	SELECT "lat_key", "lon_key", "zip_code", "resolved_at" FROM geocode_cache_new WHERE "zip_code" IS NOT NULL;
+DROP TABLE "geocode_cache_new";
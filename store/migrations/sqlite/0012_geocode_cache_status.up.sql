@@ -0,0 +1,18 @@
+-- Final negative answers are cached too, so a coordinate the geocoder
+-- found nothing at, or an address without a postal code, is not paid for
+-- again. Such rows keep a null zip code and record why in
+-- resolution_status, with the same values as transportation and permit.
+-- SQLite cannot drop a NOT NULL constraint, so the table is recreated.
+
+ALTER TABLE "geocode_cache" RENAME TO "geocode_cache_old";
+CREATE TABLE "geocode_cache" (
+	"lat_key" VARCHAR(32),
+	"lon_key" VARCHAR(32),
+	"zip_code" VARCHAR(255),
+	"resolution_status" VARCHAR(32) NOT NULL DEFAULT 'resolved',
+	"resolved_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY ("lat_key", "lon_key")
+);
+INSERT INTO geocode_cache ("lat_key", "lon_key", "zip_code", "resolved_at")
+	SELECT "lat_key", "lon_key", "zip_code", "resolved_at" FROM geocode_cache_old;
+DROP TABLE "geocode_cache_old";
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Page is the sorting and paging of a report. The zero Page returns the
+// whole report in its natural order.
+type Page struct {
+	// Sort is an output field name, the json name of a field of the
+	// report's row struct; "" keeps the report's own order.
+	Sort string
+	Desc bool
+
+	// Number is the 1-based page number. Size is the page size; 0 returns
+	// every row.
+	Number int
+	Size   int
+}
+
+// queryPage runs a report query for one page. query must select columns
+// named after the report's output fields and must not end in a semicolon;
+// it is wrapped to apply the sort, limit and offset. order is the report's
+// natural order, an ORDER BY list of output columns that tells any two
+// rows apart; it orders every sorted or paged query, after the sort field,
+// so that rows neither repeat nor go missing from one page to the next.
+// The total row count is only queried when a page size is set, and is -1
+// otherwise.
+func queryPage(db *sql.DB, query string, args []interface{}, order string, page Page) (*sql.Rows, int, error) {
+	total := -1
+	if page.Size > 0 {
+		err := db.QueryRow(`SELECT COUNT(*) FROM (`+query+`) AS report`, args...).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if page.Sort == "" && page.Size == 0 {
+		rows, err := db.Query(query, args...)
+		return rows, total, err
+	}
+
+	orderBy := order
+	if page.Sort != "" {
+		direction := "ASC"
+		if page.Desc {
+			direction = "DESC"
+		}
+		orderBy = fmt.Sprintf(`%s %s, %s`, pq.QuoteIdentifier(page.Sort), direction, order)
+	}
+	paged := `SELECT * FROM (` + query + `) AS report ORDER BY ` + orderBy
+	if page.Size > 0 {
+		paged += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+		args = append(args, page.Size, (page.Number-1)*page.Size)
+	}
+	rows, err := db.Query(paged, args...)
+	return rows, total, err
+}
+
+// placeholders returns n SQL parameter placeholders numbered from first,
+// e.g. "$3, $4", for binding a list in an IN clause.
+func placeholders(first, n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = "$" + strconv.Itoa(first+i)
+	}
+	return strings.Join(list, ", ")
+}
+
+// stringArgs converts a list for use as query arguments.
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
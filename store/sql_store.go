@@ -0,0 +1,252 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLStore is the ReportStore backed by the database, running the report
+// queries of its dialect.
+type SQLStore struct {
+	db      *sql.DB
+	queries reportQueries
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, queries: dialectOf(db).Reports}
+}
+
+// reportQueries are the SQL behind each report, which differs by dialect.
+// Each must select columns named after its report's output fields. The %s
+// in AirportTrips and CovidTrips is replaced by the airport zip code
+// placeholders, which follow the other parameters.
+type reportQueries struct {
+	AirportTrips    string
+	CovidTrips      string
+	CCVITrips       string
+	UnemployedAreas string
+	PermitAreas     string
+	TripPeriods     string
+}
+
+// The natural orders of the reports, by output column, that queryPage
+// pages them in. Each report query sorts its rows the same way.
+const (
+	airportTripsOrder    = `period_start, pickup_zip_code, number_of_trips DESC, dropoff_zip_code`
+	covidTripsOrder      = `dropoff_zip_code`
+	ccviTripsOrder       = `neighborhood_zip_code, community_area_name, number_of_trips_to, number_of_trips_from`
+	unemployedAreasOrder = `unemployment DESC, below_poverty_level DESC, community_area`
+	permitAreasOrder     = `permit_count, community_area`
+)
+
+// AirportTrips counts taxi and TNP trips from the airport zip codes to each dropoff
+// zip code, per day or week of the trip start in Chicago time.
+func (s *SQLStore) AirportTrips(q AirportTripsQuery) ([]AirportTripSummary, int, error) {
+	query := fmt.Sprintf(s.queries.AirportTrips, placeholders(4, len(q.AirportZips)))
+	args := append([]interface{}{q.Period, q.Dates.From, q.Dates.To}, stringArgs(q.AirportZips)...)
+	rows, total, err := queryPage(s.db, query, args, airportTripsOrder, q.Page)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	summaries := []AirportTripSummary{}
+	for rows.Next() {
+		var summary AirportTripSummary
+		err := rows.Scan(&summary.Airport, &summary.PickupZipCode, &summary.PeriodStart, &summary.DropoffZipCode, &summary.NumberOfTrips)
+		if err != nil {
+			return nil, 0, err
+		}
+		summaries = append(summaries, summary)
+	}
+	if total < 0 {
+		total = len(summaries)
+	}
+	return summaries, total, rows.Err()
+}
+
+func (s *SQLStore) CovidTrips(q CovidTripsQuery) ([]TripSummary, int, error) {
+	query := fmt.Sprintf(s.queries.CovidTrips, placeholders(3, len(q.AirportZips)))
+	args := append([]interface{}{q.Dates.From, q.Dates.To}, stringArgs(q.AirportZips)...)
+	rows, total, err := queryPage(s.db, query, args, covidTripsOrder, q.Page)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	summaries := []TripSummary{}
+	for rows.Next() {
+		var summary TripSummary
+		err := rows.Scan(&summary.DropoffZipCode, &summary.NumberOfTrips, &summary.TotalPosCases)
+		if err != nil {
+			return nil, 0, err
+		}
+		summaries = append(summaries, summary)
+	}
+	if total < 0 {
+		total = len(summaries)
+	}
+	return summaries, total, rows.Err()
+}
+
+func (s *SQLStore) CCVITrips(q CCVITripsQuery) ([]CCVITripSummary, int, error) {
+	query := s.queries.CCVITrips
+	rows, total, err := queryPage(s.db, query, []interface{}{q.Category, q.Dates.From, q.Dates.To}, ccviTripsOrder, q.Page)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	summaries := []CCVITripSummary{}
+	for rows.Next() {
+		var summary CCVITripSummary
+		err := rows.Scan(&summary.NeighborhoodZipCode, &summary.CommunityAreaName, &summary.NumberOfTripsTo, &summary.NumberOfTripsFrom)
+		if err != nil {
+			return nil, 0, err
+		}
+		summaries = append(summaries, summary)
+	}
+	if total < 0 {
+		total = len(summaries)
+	}
+	return summaries, total, rows.Err()
+}
+
+func (s *SQLStore) UnemployedAreas(q UnemploymentQuery) ([]UnemployNeighborhoodSummary, int, error) {
+	query := s.queries.UnemployedAreas
+
+	rows, total, err := queryPage(s.db, query, []interface{}{q.Dates.From, q.Dates.To, q.Limit}, unemployedAreasOrder, q.Page)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	summaries := []UnemployNeighborhoodSummary{}
+	for rows.Next() {
+		var summary UnemployNeighborhoodSummary
+		err := rows.Scan(&summary.CommunityArea, &summary.Unemployment, &summary.BelowPovertyLevel)
+		if err != nil {
+			return nil, 0, err
+		}
+		summaries = append(summaries, summary)
+	}
+	if total < 0 {
+		total = len(summaries)
+	}
+	return summaries, total, rows.Err()
+}
+
+func (s *SQLStore) PermitAreas(q PermitQuery) ([]LoanNeighborhoodSummary, int, error) {
+	query := s.queries.PermitAreas
+
+	rows, total, err := queryPage(s.db, query, []interface{}{q.PermitType, q.IncomeBelow, q.Dates.From, q.Dates.To, q.Limit}, permitAreasOrder, q.Page)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	summaries := []LoanNeighborhoodSummary{}
+	for rows.Next() {
+		var summary LoanNeighborhoodSummary
+		err := rows.Scan(&summary.CommunityArea, &summary.PermitCount, &summary.PerCapitaIncome)
+		if err != nil {
+			return nil, 0, err
+		}
+		summaries = append(summaries, summary)
+	}
+	if total < 0 {
+		total = len(summaries)
+	}
+	return summaries, total, rows.Err()
+}
+
+// TripPeriods counts trips per pickup and per dropoff zip code in each day,
+// week or month of the trip start in Chicago time.
+func (s *SQLStore) TripPeriods(q TripPeriodsQuery) ([]TripPeriodCount, error) {
+	query := s.queries.TripPeriods
+	rows, err := s.db.Query(query, q.Period, q.ZipCode, q.Dates.From, q.Dates.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []TripPeriodCount
+	for rows.Next() {
+		var c TripPeriodCount
+		if err := rows.Scan(&c.Direction, &c.ZipCode, &c.PeriodStart, &c.NumberOfTrips); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// geometryQueries select the stored outline of each kind of area.
+var geometryQueries = map[string]string{
+	ZipCodeArea:   `SELECT "zip_code", "the_geom" FROM boundaries WHERE "the_geom" IS NOT NULL AND "zip_code" IN (%s)`,
+	CommunityArea: `SELECT "community_area", "the_geom" FROM community_areas WHERE "the_geom" IS NOT NULL AND "community_area" IN (%s)`,
+}
+
+func (s *SQLStore) Geometries(kind string, keys []string) (map[string]json.RawMessage, error) {
+	geometries := map[string]json.RawMessage{}
+
+	keys = uniqueStrings(keys)
+	if len(keys) == 0 {
+		return geometries, nil
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(geometryQueries[kind], placeholders(1, len(keys))), stringArgs(keys)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, geom string
+		if err := rows.Scan(&key, &geom); err != nil {
+			return nil, err
+		}
+		if _, ok := geometries[key]; !ok {
+			geometries[key] = json.RawMessage(geom)
+		}
+	}
+	return geometries, rows.Err()
+}
+
+func (s *SQLStore) AsOf(summary string) (*time.Time, error) {
+	var asOf time.Time
+	err := s.db.QueryRow(`SELECT "refreshed_at" FROM report_refreshes WHERE "summary" = $1`, summary).Scan(&asOf)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &asOf, nil
+}
+
+// uniqueStrings returns list without repeats, in first-seen order.
+func uniqueStrings(list []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, v := range list {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// GeometryText converts a GeoJSON geometry from a SODA record for storage,
+// as NULL if the record has none.
+func GeometryText(geom json.RawMessage) sql.NullString {
+	text := strings.TrimSpace(string(geom))
+	if text == "" || text == "null" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: text, Valid: true}
+}
@@ -0,0 +1,115 @@
+package store
+
+// sqlitePeriodStart truncates trip_date to the start of the day, week (from
+// Monday) or month named by $1, as date_trunc does on Postgres. Dates are
+// YYYY-MM-DD text.
+const sqlitePeriodStart = `CASE $1
+		WHEN 'week' THEN date(trip_date, '-6 days', 'weekday 1')
+		WHEN 'month' THEN date(trip_date, 'start of month')
+		ELSE trip_date END`
+
+// sqliteReports are the report queries on SQLite. They follow
+// postgresReports, comparing dates as text and casting with CAST.
+var sqliteReports = reportQueries{
+	AirportTrips: `
+		SELECT
+			CASE trips.pickup_zip_code WHEN '60666' THEN 'O''Hare' WHEN '60638' THEN 'Midway' ELSE '' END AS airport,
+			trips.pickup_zip_code, trips.period_start, trips.dropoff_zip_code,
+			SUM(trips.number_of_trips) AS number_of_trips
+		FROM (
+			SELECT pickup_zip_code, dropoff_zip_code, number_of_trips, ` + sqlitePeriodStart + ` AS period_start
+			FROM trip_counts
+			WHERE pickup_zip_code IN (%s) AND dropoff_zip_code IS NOT NULL
+				AND ($2 IS NULL OR trip_date >= $2)
+				AND ($3 IS NULL OR trip_date <= $3)
+			) AS trips
+		GROUP BY trips.pickup_zip_code, trips.period_start, trips.dropoff_zip_code
+		ORDER BY trips.period_start, trips.pickup_zip_code, number_of_trips DESC, trips.dropoff_zip_code
+	`,
+	CovidTrips: `
+		SELECT trips.dropoff_zip_code, trips.number_of_trips, covid_cases.total_pos_cases
+		FROM covid_cases
+		JOIN (
+			SELECT dropoff_zip_code, SUM(number_of_trips) AS number_of_trips
+			FROM trip_counts
+			WHERE pickup_zip_code IN (%s)
+				AND ($1 IS NULL OR trip_date >= $1)
+				AND ($2 IS NULL OR trip_date <= $2)
+			GROUP BY dropoff_zip_code
+			) AS trips
+		ON covid_cases.zip_code = trips.dropoff_zip_code
+		ORDER BY trips.dropoff_zip_code
+	`,
+	CCVITrips: `
+		SELECT tb1.community_area_or_zip AS neighborhood_zip_code, tb1.community_area_name, tb1.number_of_trips_to, tb2.number_of_trips_from
+		FROM (
+			SELECT ccvi_zip.community_area_or_zip, ccvi_zip.community_area_name, SUM(trip_counts.number_of_trips) AS number_of_trips_to
+			FROM ccvi_zip_codes ccvi_zip
+			JOIN trip_counts
+			ON ccvi_zip.zip_code = trip_counts.pickup_zip_code
+			WHERE ccvi_zip.ccvi_category = $1
+				AND ($2 IS NULL OR trip_counts.trip_date >= $2)
+				AND ($3 IS NULL OR trip_counts.trip_date <= $3)
+			GROUP BY ccvi_zip.community_area_or_zip, ccvi_zip.community_area_name
+		) AS tb1
+		JOIN (
+			SELECT ccvi_zip.community_area_or_zip, ccvi_zip.community_area_name, SUM(trip_counts.number_of_trips) AS number_of_trips_from
+			FROM ccvi_zip_codes ccvi_zip
+			JOIN trip_counts
+			ON ccvi_zip.zip_code = trip_counts.dropoff_zip_code
+			WHERE ccvi_zip.ccvi_category = $1
+				AND ($2 IS NULL OR trip_counts.trip_date >= $2)
+				AND ($3 IS NULL OR trip_counts.trip_date <= $3)
+			GROUP BY ccvi_zip.community_area_or_zip, ccvi_zip.community_area_name
+		) AS tb2
+		ON tb1.community_area_or_zip = tb2.community_area_or_zip
+		ORDER BY tb1.community_area_or_zip, tb1.community_area_name, tb1.number_of_trips_to, tb2.number_of_trips_from
+	`,
+	UnemployedAreas: `
+		SELECT unemployment.community_area, unemployment.unemployment, unemployment.below_poverty_level
+		FROM unemployment
+		WHERE EXISTS (
+			SELECT 1
+			FROM permit_counts
+			WHERE unemployment.community_area = CAST(permit_counts.community_area AS TEXT)
+				AND ($1 IS NULL OR permit_counts.issue_date >= $1)
+				AND ($2 IS NULL OR permit_counts.issue_date <= $2)
+			)
+		ORDER BY unemployment.unemployment DESC, unemployment.below_poverty_level DESC, unemployment.community_area
+		LIMIT $3
+	`,
+	PermitAreas: `
+		SELECT
+			unemployment.community_area,
+			SUM(permit_counts.number_of_permits) AS permit_count,
+			unemployment.per_capita_income
+		FROM unemployment
+		JOIN permit_counts
+		ON unemployment.community_area = CAST(permit_counts.community_area AS TEXT)
+		WHERE permit_counts.permit_type = $1 AND unemployment.per_capita_income < $2
+			AND ($3 IS NULL OR permit_counts.issue_date >= $3)
+			AND ($4 IS NULL OR permit_counts.issue_date <= $4)
+		GROUP BY unemployment.community_area, unemployment.per_capita_income
+		ORDER BY permit_count ASC, unemployment.community_area
+		LIMIT $5
+	`,
+	TripPeriods: `
+		SELECT trips.direction, trips.zip_code, trips.period_start, SUM(trips.number_of_trips) AS number_of_trips
+		FROM (
+			SELECT 'pickup' AS direction, pickup_zip_code AS zip_code, number_of_trips,
+				` + sqlitePeriodStart + ` AS period_start, trip_date
+			FROM trip_counts
+			WHERE pickup_zip_code IS NOT NULL
+			UNION ALL
+			SELECT 'dropoff' AS direction, dropoff_zip_code AS zip_code, number_of_trips,
+				` + sqlitePeriodStart + ` AS period_start, trip_date
+			FROM trip_counts
+			WHERE dropoff_zip_code IS NOT NULL
+			) AS trips
+		WHERE ($2 IS NULL OR trips.zip_code = $2)
+			AND ($3 IS NULL OR trips.trip_date >= $3)
+			AND ($4 IS NULL OR trips.trip_date <= $4)
+		GROUP BY trips.direction, trips.zip_code, trips.period_start
+		ORDER BY trips.zip_code, trips.direction DESC, trips.period_start
+	`,
+}
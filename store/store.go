@@ -0,0 +1,154 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ReportStore answers the report queries. SQLStore reads the
+// database; MemoryStore computes the same reports from in-memory tables.
+type ReportStore interface {
+	// AirportTrips backs req1.
+	AirportTrips(q AirportTripsQuery) ([]AirportTripSummary, int, error)
+	// CovidTrips backs req2.
+	CovidTrips(q CovidTripsQuery) ([]TripSummary, int, error)
+	// CCVITrips backs req3.
+	CCVITrips(q CCVITripsQuery) ([]CCVITripSummary, int, error)
+	// TripPeriods backs req4.
+	TripPeriods(q TripPeriodsQuery) ([]TripPeriodCount, error)
+	// UnemployedAreas backs req5.
+	UnemployedAreas(q UnemploymentQuery) ([]UnemployNeighborhoodSummary, int, error)
+	// PermitAreas backs req6.
+	PermitAreas(q PermitQuery) ([]LoanNeighborhoodSummary, int, error)
+
+	// Geometries returns the GeoJSON outline of each of keys, zip codes or
+	// community areas depending on kind. Keys without one are left out.
+	Geometries(kind string, keys []string) (map[string]json.RawMessage, error)
+
+	// AsOf returns when the named summary table was last refreshed, or nil
+	// if it never has been.
+	AsOf(summary string) (*time.Time, error)
+}
+
+// DateLayout is the format of dates in queries and report rows, e.g.
+// 2023-01-31.
+const DateLayout = "2006-01-02"
+
+// DateRange is an inclusive range of calendar days. A null end is open.
+type DateRange struct {
+	From, To sql.NullString
+}
+
+// contains reports whether date, formatted like DateLayout, falls in the
+// range. As in SQL, an empty (null) date is outside any bounded range.
+func (d DateRange) contains(date string) bool {
+	if d.From.Valid && (date == "" || date < d.From.String) {
+		return false
+	}
+	if d.To.Valid && (date == "" || date > d.To.String) {
+		return false
+	}
+	return true
+}
+
+// The paged report methods return one page of rows and the row count of
+// the whole report.
+
+type AirportTripsQuery struct {
+	Period      string
+	AirportZips []string
+	Dates       DateRange
+	Page        Page
+}
+
+type CovidTripsQuery struct {
+	AirportZips []string
+	Dates       DateRange
+	Page        Page
+}
+
+type CCVITripsQuery struct {
+	Category string
+	Dates    DateRange
+	Page     Page
+}
+
+type TripPeriodsQuery struct {
+	Period  string
+	ZipCode sql.NullString
+	Dates   DateRange
+}
+
+type UnemploymentQuery struct {
+	Limit int
+	Dates DateRange
+	Page  Page
+}
+
+type PermitQuery struct {
+	PermitType  string
+	IncomeBelow int
+	Limit       int
+	Dates       DateRange
+	Page        Page
+}
+
+// TripPeriodCount is the number of trips picked up or dropped off in a zip
+// code in one day, week or month.
+type TripPeriodCount struct {
+	Direction     string
+	ZipCode       string
+	PeriodStart   string
+	NumberOfTrips int
+}
+
+type AirportTripSummary struct {
+	Airport        string `json:"airport" parquet:"name=airport, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PickupZipCode  string `json:"pickup_zip_code" parquet:"name=pickup_zip_code, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PeriodStart    string `json:"period_start" parquet:"name=period_start, type=BYTE_ARRAY, convertedtype=UTF8"`
+	DropoffZipCode string `json:"dropoff_zip_code" parquet:"name=dropoff_zip_code, type=BYTE_ARRAY, convertedtype=UTF8"`
+	NumberOfTrips  int    `json:"number_of_trips" parquet:"name=number_of_trips, type=INT64"`
+}
+
+type TripSummary struct {
+	DropoffZipCode string  `json:"dropoff_zip_code" parquet:"name=dropoff_zip_code, type=BYTE_ARRAY, convertedtype=UTF8"`
+	NumberOfTrips  int     `json:"number_of_trips" parquet:"name=number_of_trips, type=INT64"`
+	TotalPosCases  float64 `json:"total_pos_cases" parquet:"name=total_pos_cases, type=DOUBLE"`
+}
+
+type CCVITripSummary struct {
+	NeighborhoodZipCode string `json:"neighborhood_zip_code" parquet:"name=neighborhood_zip_code, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CommunityAreaName   string `json:"community_area_name" parquet:"name=community_area_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	NumberOfTripsTo     int    `json:"number_of_trips_to" parquet:"name=number_of_trips_to, type=INT64"`
+	NumberOfTripsFrom   int    `json:"number_of_trips_from" parquet:"name=number_of_trips_from, type=INT64"`
+}
+
+type UnemployNeighborhoodSummary struct {
+	CommunityArea     string  `json:"community_area" parquet:"name=community_area, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Unemployment      float64 `json:"unemployment" parquet:"name=unemployment, type=DOUBLE"`
+	BelowPovertyLevel float64 `json:"below_poverty_level" parquet:"name=below_poverty_level, type=DOUBLE"`
+}
+
+type LoanNeighborhoodSummary struct {
+	CommunityArea   string `json:"community_area" parquet:"name=community_area, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PermitCount     int    `json:"permit_count" parquet:"name=permit_count, type=INT64"`
+	PerCapitaIncome int    `json:"per_capita_income" parquet:"name=per_capita_income, type=INT64"`
+}
+
+// Kinds of area a report row can be drawn as, for Geometries.
+const (
+	ZipCodeArea   = "zip_code"
+	CommunityArea = "community_area"
+)
+
+// Area returns the kind and key of the area a report row describes.
+func (s AirportTripSummary) Area() (string, string) { return ZipCodeArea, s.DropoffZipCode }
+func (s TripSummary) Area() (string, string)        { return ZipCodeArea, s.DropoffZipCode }
+
+// NeighborhoodZipCode holds ccvi.community_area_or_zip, which req3 joins to
+// community areas.
+func (s CCVITripSummary) Area() (string, string) { return CommunityArea, s.NeighborhoodZipCode }
+
+func (s UnemployNeighborhoodSummary) Area() (string, string) { return CommunityArea, s.CommunityArea }
+func (s LoanNeighborhoodSummary) Area() (string, string)     { return CommunityArea, s.CommunityArea }
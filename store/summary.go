@@ -0,0 +1,137 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SummaryTable is a table of precomputed report data, rebuilt from scratch
+// by Rebuild after the jobs that feed it finish. Rebuild holds the
+// statements for each dialect, by name; it is empty for a table reports
+// read as loaded, whose refresh only records when it was loaded.
+type SummaryTable struct {
+	Name    string
+	Rebuild map[string][]string
+}
+
+// TripCounts counts trips per pickup zip, dropoff zip and day in Chicago.
+// It backs req1 through req4. Both databases keep trip timestamps as SODA
+// sends them, in Chicago local time, so the day is their date.
+var TripCounts = SummaryTable{
+	Name: "trip_counts",
+	Rebuild: map[string][]string{
+		PostgresDriver: {
+			`DELETE FROM trip_counts`,
+			`INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips")
+				SELECT "pickup_zip_code", "dropoff_zip_code", "trip_start_timestamp"::DATE, COUNT(*)
+				FROM transportation
+				WHERE "trip_start_timestamp" IS NOT NULL
+				GROUP BY 1, 2, 3`,
+		},
+		SQLiteDriver: {
+			`DELETE FROM trip_counts`,
+			`INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips")
+				SELECT "pickup_zip_code", "dropoff_zip_code", date("trip_start_timestamp"), COUNT(*)
+				FROM transportation
+				WHERE "trip_start_timestamp" IS NOT NULL
+				GROUP BY 1, 2, 3`,
+		},
+	},
+}
+
+// PermitCounts counts permits per community area, type and issue date. It
+// backs req5 and req6.
+var PermitCounts = SummaryTable{
+	Name: "permit_counts",
+	Rebuild: map[string][]string{
+		PostgresDriver: {
+			`DELETE FROM permit_counts`,
+			`INSERT INTO permit_counts ("community_area", "permit_type", "issue_date", "number_of_permits")
+				SELECT "community_area", "permit_type", "issue_date"::DATE, COUNT(*)
+				FROM permit
+				GROUP BY 1, 2, 3`,
+		},
+		SQLiteDriver: {
+			`DELETE FROM permit_counts`,
+			`INSERT INTO permit_counts ("community_area", "permit_type", "issue_date", "number_of_permits")
+				SELECT "community_area", "permit_type", date("issue_date"), COUNT(*)
+				FROM permit
+				GROUP BY 1, 2, 3`,
+		},
+	},
+}
+
+// CovidCases totals positive COVID cases per zip code. It backs req2.
+var CovidCases = SummaryTable{
+	Name: "covid_cases",
+	Rebuild: map[string][]string{
+		PostgresDriver: {
+			`DELETE FROM covid_cases`,
+			`INSERT INTO covid_cases ("zip_code", "total_pos_cases")
+				SELECT "zip_code", SUM("tests" * "percentage_positive")
+				FROM covid
+				WHERE "zip_code" IS NOT NULL
+				GROUP BY 1`,
+		},
+		SQLiteDriver: {
+			`DELETE FROM covid_cases`,
+			`INSERT INTO covid_cases ("zip_code", "total_pos_cases")
+				SELECT "zip_code", SUM("tests" * "percentage_positive")
+				FROM covid
+				WHERE "zip_code" IS NOT NULL
+				GROUP BY 1`,
+		},
+	},
+}
+
+// CCVIZipCodes pairs each community area in the CCVI with the zip codes
+// in its boundaries. It backs req3.
+var CCVIZipCodes = SummaryTable{
+	Name: "ccvi_zip_codes",
+	Rebuild: map[string][]string{
+		PostgresDriver: {
+			`DELETE FROM ccvi_zip_codes`,
+			`INSERT INTO ccvi_zip_codes ("community_area_or_zip", "community_area_name", "ccvi_category", "zip_code")
+				SELECT ccvi."community_area_or_zip", ccvi."community_area_name", ccvi."ccvi_category", boundaries."zip_code"
+				FROM ccvi
+				JOIN boundaries
+				ON ccvi."community_area_or_zip"::TEXT = boundaries."community_area"`,
+		},
+		SQLiteDriver: {
+			`DELETE FROM ccvi_zip_codes`,
+			`INSERT INTO ccvi_zip_codes ("community_area_or_zip", "community_area_name", "ccvi_category", "zip_code")
+				SELECT ccvi."community_area_or_zip", ccvi."community_area_name", ccvi."ccvi_category", boundaries."zip_code"
+				FROM ccvi
+				JOIN boundaries
+				ON CAST(ccvi."community_area_or_zip" AS TEXT) = boundaries."community_area"`,
+		},
+	},
+}
+
+// Unemployment is the unemployment table, which req5 and req6 read as
+// loaded; refreshing it records when it was loaded.
+var Unemployment = SummaryTable{Name: "unemployment"}
+
+// Refresh rebuilds the table and records when, in one transaction, so
+// reports never see it half built. Rebuilds of the same table run one at
+// a time: each deletes only the rows committed when it starts, so two that
+// overlap would otherwise both insert a full copy.
+func (s SummaryTable) Refresh(db *sql.DB) error {
+	d := dialectOf(db)
+	rebuild := s.Rebuild[d.Name]
+	return inTx(db, func(tx *sql.Tx) error {
+		if d.LockSummary != "" {
+			if _, err := tx.Exec(d.LockSummary, s.Name); err != nil {
+				return fmt.Errorf("locking %s: %v", s.Name, err)
+			}
+		}
+		for _, stmt := range rebuild {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("refreshing %s: %v", s.Name, err)
+			}
+		}
+		_, err := tx.Exec(`INSERT INTO report_refreshes ("summary", "refreshed_at") VALUES ($1, CURRENT_TIMESTAMP)
+			ON CONFLICT ("summary") DO UPDATE SET "refreshed_at" = EXCLUDED."refreshed_at"`, s.Name)
+		return err
+	})
+}
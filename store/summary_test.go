@@ -0,0 +1,156 @@
+package store
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// testDBs returns a migrated SQLite database, and a Postgres one if
+// CBI_TEST_POSTGRES_DSN names a throwaway database the tests may fill.
+func testDBs(t *testing.T) map[string]*sql.DB {
+	dbs := map[string]*sql.DB{}
+
+	db, err := Open(Config{Driver: SQLiteDriver, Path: filepath.Join(t.TempDir(), "cbi.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs[SQLiteDriver] = db
+
+	if dsn := os.Getenv("CBI_TEST_POSTGRES_DSN"); dsn != "" {
+		db, err := sql.Open(PostgresDriver, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dbs[PostgresDriver] = db
+	}
+
+	for _, db := range dbs {
+		db := db
+		t.Cleanup(func() { db.Close() })
+		if _, err := MigrateUp(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dbs
+}
+
+// Overlapping rebuilds of a summary leave one copy of each row.
+func TestRefreshConcurrently(t *testing.T) {
+	for name, db := range testDBs(t) {
+		for _, stmt := range []string{
+			`DELETE FROM transportation`,
+			`DELETE FROM ccvi`,
+			`DELETE FROM boundaries`,
+			`INSERT INTO transportation ("trip_id", "trip_start_timestamp", "pickup_zip_code", "dropoff_zip_code") VALUES
+				('t1', '2023-01-02 12:00:00', '60666', '60611'),
+				('t2', '2023-01-02 13:00:00', '60666', '60611'),
+				('t3', '2023-01-03 12:00:00', '60611', NULL)`,
+			`INSERT INTO ccvi ("community_area_or_zip", "geography_type", "community_area_name", "ccvi_category") VALUES (8, 'CA', 'Near North Side', 'HIGH')`,
+			`INSERT INTO boundaries ("community_area", "zip_code") VALUES ('8', '60610'), ('8', '60611')`,
+		} {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("%s: %s: %v", name, stmt, err)
+			}
+		}
+
+		for _, summary := range []SummaryTable{TripCounts, CCVIZipCodes} {
+			var wg sync.WaitGroup
+			errs := make(chan error, 4)
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- summary.Refresh(db)
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+		}
+
+		var rows, trips int
+		if err := db.QueryRow(`SELECT COUNT(*), SUM("number_of_trips") FROM trip_counts`).Scan(&rows, &trips); err != nil {
+			t.Fatal(err)
+		}
+		if rows != 2 || trips != 3 {
+			t.Errorf("%s: got %d trip_counts rows of %d trips, want 2 of 3", name, rows, trips)
+		}
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ccvi_zip_codes`).Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+		if rows != 2 {
+			t.Errorf("%s: got %d ccvi_zip_codes rows, want 2", name, rows)
+		}
+	}
+}
+
+// A copied row fails the rebuild rather than doubling a count.
+func TestSummaryKeys(t *testing.T) {
+	for name, db := range testDBs(t) {
+		for _, stmt := range []string{
+			`DELETE FROM trip_counts`,
+			`DELETE FROM ccvi_zip_codes`,
+			`INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips") VALUES ('60611', NULL, '2023-01-03', 1)`,
+			`INSERT INTO ccvi_zip_codes ("community_area_or_zip", "community_area_name", "ccvi_category", "zip_code") VALUES (8, 'Near North Side', 'HIGH', '60611')`,
+		} {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("%s: %s: %v", name, stmt, err)
+			}
+		}
+		for _, stmt := range []string{
+			`INSERT INTO trip_counts ("pickup_zip_code", "dropoff_zip_code", "trip_date", "number_of_trips") VALUES ('60611', NULL, '2023-01-03', 1)`,
+			`INSERT INTO ccvi_zip_codes ("community_area_or_zip", "community_area_name", "ccvi_category", "zip_code") VALUES (8, 'Near North Side', 'HIGH', '60611')`,
+		} {
+			if _, err := db.Exec(stmt); err == nil {
+				t.Errorf("%s: inserted a copy with %s", name, stmt)
+			}
+		}
+	}
+}
+
+// Trips are counted on the Chicago day they start, even just after
+// midnight.
+func TestTripCountsDay(t *testing.T) {
+	for name, db := range testDBs(t) {
+		for _, stmt := range []string{
+			`DELETE FROM transportation`,
+			`INSERT INTO transportation ("trip_id", "trip_start_timestamp", "pickup_zip_code", "dropoff_zip_code") VALUES
+				('t1', '2023-01-02T23:59:00.000', '60611', '60601'),
+				('t2', '2023-01-03T00:05:00.000', '60611', '60601'),
+				('t3', '2023-01-03T05:30:00.000', '60611', '60601')`,
+		} {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("%s: %s: %v", name, stmt, err)
+			}
+		}
+		if err := TripCounts.Refresh(db); err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := db.Query(`SELECT CAST("trip_date" AS TEXT), "number_of_trips" FROM trip_counts ORDER BY 1`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]int{}
+		for rows.Next() {
+			var date string
+			var n int
+			if err := rows.Scan(&date, &n); err != nil {
+				t.Fatal(err)
+			}
+			got[date] = n
+		}
+		rows.Close()
+		if want := map[string]int{"2023-01-02": 1, "2023-01-03": 2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got trips per day %v, want %v", name, got, want)
+		}
+	}
+}